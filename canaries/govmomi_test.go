@@ -44,6 +44,53 @@ func TestVirtualMachineConfigInfo(t *testing.T) {
 		}
 	})
 
+	t.Run("Decode strict", func(t *testing.T) {
+		f, err := os.Open("./testdata/vminfo.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		dec := json.NewDecoder(f)
+		dec.SetDiscriminator(
+			"_typeName", "_value",
+			json.DiscriminatorToTypeFunc(types.TypeFunc()),
+		)
+		dec.DisallowUnknownFields()
+		dec.DisallowTypeNameMismatch()
+
+		var vmInfo types.VirtualMachineConfigInfo
+		if err := dec.Decode(&vmInfo); err != nil {
+			t.Fatal(err)
+		}
+
+		a, e := vmInfo, vmInfoObjForTests
+
+		if diff := cmp.Diff(a, e); diff != "" {
+			t.Errorf("mismatched vminfo: %s", diff)
+		}
+	})
+
+	t.Run("Decode mismatch", func(t *testing.T) {
+		data, err := os.ReadFile("./testdata/vminfo.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.SetDiscriminator(
+			"_typeName", "_value",
+			json.DiscriminatorToTypeFunc(types.TypeFunc()),
+		)
+		dec.DisallowTypeNameMismatch()
+
+		var vmInfo types.VirtualMachineConfigSpec
+		err = dec.Decode(&vmInfo)
+		if a, e := err, "json: discriminator type VirtualMachineConfigInfo does not match types.VirtualMachineConfigSpec"; a == nil || a.Error() != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+		}
+	})
+
 	t.Run("Encode", func(t *testing.T) {
 		expJSON, err := os.ReadFile("./testdata/vminfo.json")
 		if err != nil {
@@ -0,0 +1,118 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+var codecForTests = json.NewCodec(json.CodecOptions{
+	TypeFieldName:  "_t",
+	ValueFieldName: "_v",
+	TypeFn:         discriminatorToTypeFn,
+})
+
+func TestCodec(t *testing.T) {
+	t.Run("Marshal", func(t *testing.T) {
+		data, err := codecForTests.Marshal(DS1{F1: DS3{F1: "hello"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, e := string(data), `{"f1":{"_t":"DS3","f1":"hello"}}`; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+	})
+
+	t.Run("Unmarshal", func(t *testing.T) {
+		var obj DS1
+		if err := codecForTests.Unmarshal(
+			[]byte(`{"f1":{"_t":"DS3","f1":"hello"}}`), &obj); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, obj, DS1{F1: DS3{F1: "hello"}})
+	})
+
+	t.Run("Encoder and Decoder", func(t *testing.T) {
+		var w bytes.Buffer
+		if err := codecForTests.NewEncoder(&w).Encode(DS1{F1: uint8(1)}); err != nil {
+			t.Fatal(err)
+		}
+		if a, e := w.String(), `{"f1":{"_t":"uint8","_v":1}}`+"\n"; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+		var obj DS1
+		if err := codecForTests.NewDecoder(&w).Decode(&obj); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, obj, DS1{F1: uint8(1)})
+	})
+
+	t.Run("Indent and HTML escape", func(t *testing.T) {
+		c := json.NewCodec(json.CodecOptions{
+			IndentPrefix:      ">",
+			Indent:            "  ",
+			DisableHTMLEscape: true,
+		})
+		data, err := c.Marshal(DS3{F1: "<&>"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, e := string(data), "{\n>  \"f1\": \"<&>\"\n>}"; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+		var w bytes.Buffer
+		if err := c.NewEncoder(&w).Encode(DS3{F1: "<&>"}); err != nil {
+			t.Fatal(err)
+		}
+		if a, e := w.String(), string(data)+"\n"; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+	})
+
+	t.Run("UseNumber and DisallowUnknownFields", func(t *testing.T) {
+		c := json.NewCodec(json.CodecOptions{
+			UseNumber:             true,
+			DisallowUnknownFields: true,
+		})
+		var obj DS1
+		if err := c.Unmarshal([]byte(`{"f1":1}`), &obj); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, obj, DS1{F1: json.Number("1")})
+		err := c.NewDecoder(strings.NewReader(`{"f2":1}`)).Decode(&obj)
+		if a, e := err, `json: unknown field "f2"`; a == nil || a.Error() != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				data, err := codecForTests.Marshal(DS1{F1: DS4{F1: "hello", F2: int(1)}})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				var obj DS1
+				if err := codecForTests.Unmarshal(data, &obj); err != nil {
+					t.Error(err)
+					return
+				}
+				if obj.F1.(DS4).F2 != int(1) {
+					t.Errorf("unexpected value: %+v", obj)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
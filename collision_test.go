@@ -0,0 +1,179 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"reflect"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+type typeFieldCollision struct {
+	Type string `json:"_t"`
+}
+
+type typeFieldFoldCollision struct {
+	Kind string
+}
+
+type mapStringStringField struct {
+	M map[string]string `json:"m"`
+}
+
+func TestDiscriminatorKeyCollision(t *testing.T) {
+	c := json.NewCodec(json.CodecOptions{
+		TypeFieldName:  "_t",
+		ValueFieldName: "_v",
+		TypeFn:         discriminatorToTypeFn,
+	})
+
+	t.Run("Struct field", func(t *testing.T) {
+		_, err := c.Marshal(DS1{F1: typeFieldCollision{Type: "a"}})
+		if a, e := err, `json: discriminator type field "_t" collides with a field of json_test.typeFieldCollision`; a == nil || a.Error() != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+		}
+
+		_, err = json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			EncodeMode:     json.DiscriminatorEncodeTypeNameAllObjects,
+		}).Marshal(typeFieldCollision{Type: "a"})
+		if a, e := err, `json: discriminator type field "_t" collides with a field of json_test.typeFieldCollision`; a == nil || a.Error() != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+		}
+
+		// The type field is not encoded so there is no collision.
+		data, err := c.Marshal(typeFieldCollision{Type: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, e := string(data), `{"_t":"a"}`; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+	})
+
+	t.Run("Struct field on decode", func(t *testing.T) {
+		types := json.NewTypeRegistry()
+		if err := types.Register(reflect.TypeOf(typeFieldCollision{}), "typeFieldCollision"); err != nil {
+			t.Fatal(err)
+		}
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeRegistry:   types,
+		})
+		for _, str := range []string{
+			// The type field is the first field.
+			`{"f1":{"_t":"typeFieldCollision"}}`,
+			// The type field follows the other fields.
+			`{"f1":{"x":1,"_t":"typeFieldCollision"}}`,
+		} {
+			var obj DS1
+			err := c.Unmarshal([]byte(str), &obj)
+			if a, e := err, `json: discriminator type field "_t" collides with a field of json_test.typeFieldCollision`; a == nil || a.Error() != e {
+				t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+			}
+		}
+
+		// The object is not decoded from its type name so there is no
+		// collision.
+		var obj typeFieldCollision
+		if err := c.Unmarshal([]byte(`{"_t":"a"}`), &obj); err != nil {
+			t.Fatal(err)
+		}
+		assertDeepEqual(t, obj, typeFieldCollision{Type: "a"})
+	})
+
+	t.Run("Case-insensitive struct field", func(t *testing.T) {
+		// The type field of the interface collides with the struct field
+		// since the key "kind" is decoded into the field Kind.
+		types := json.NewTypeRegistry()
+		if err := types.Register(reflect.TypeOf(typeFieldFoldCollision{}), "fold"); err != nil {
+			t.Fatal(err)
+		}
+		r := json.NewTypeRegistry()
+		if err := r.RegisterInterface(reflect.TypeOf((*interface{})(nil)).Elem(), json.InterfaceDiscriminator{
+			TypeFieldName:  "kind",
+			ValueFieldName: "value",
+			Types:          types,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeRegistry:   r,
+		})
+		e := `json: discriminator type field "kind" collides with a field of json_test.typeFieldFoldCollision`
+		if _, err := c.Marshal(DS1{F1: typeFieldFoldCollision{}}); err == nil || err.Error() != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, err)
+		}
+		for _, str := range []string{
+			`{"f1":{"kind":"fold","x":1}}`,
+			`{"f1":{"x":1,"kind":"fold"}}`,
+		} {
+			var obj DS1
+			if err := c.Unmarshal([]byte(str), &obj); err == nil || err.Error() != e {
+				t.Errorf("%s: expected error mismatch: e=%v, a=%v", str, e, err)
+			}
+		}
+	})
+
+	for _, tc := range []struct {
+		name string
+		obj  interface{}
+		str  string
+	}{
+		{
+			name: "Map in interface",
+			obj:  DS1{F1: map[string]string{"_t": "a", "__t": "b", "x_t": "c", "_": "d", "t": "e"}},
+			str:  `{"f1":{"_t":"map[string]string","_":"d","___t":"b","__t":"a","t":"e","x_t":"c"}}`,
+		},
+		{
+			name: "Map in struct",
+			obj:  mapStringStringField{M: map[string]string{"_t": "a", "__t": "b"}},
+			str:  `{"m":{"___t":"b","__t":"a"}}`,
+		},
+		{
+			name: "Map without collisions",
+			obj:  mapStringStringField{M: map[string]string{"a": "b"}},
+			str:  `{"m":{"a":"b"}}`,
+		},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := c.Marshal(tc.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := string(data), tc.str; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			switch tc.obj.(type) {
+			case DS1:
+				var obj DS1
+				if err := c.Unmarshal(data, &obj); err != nil {
+					t.Fatal(err)
+				}
+				assertDeepEqual(t, obj, tc.obj)
+			case mapStringStringField:
+				var obj mapStringStringField
+				if err := c.Unmarshal(data, &obj); err != nil {
+					t.Fatal(err)
+				}
+				assertDeepEqual(t, obj, tc.obj)
+			}
+		})
+	}
+
+	t.Run("Escaped prefix", func(t *testing.T) {
+		var obj mapStringStringField
+		if err := c.Unmarshal([]byte(`{"m":{"_t":"a","\u005f_t":"b"}}`), &obj); err != nil {
+			t.Fatal(err)
+		}
+		assertDeepEqual(t, obj, mapStringStringField{M: map[string]string{"_t": "b"}})
+	})
+}
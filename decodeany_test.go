@@ -0,0 +1,52 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+func TestDecoderDecodeAny(t *testing.T) {
+	str := `{"_t":"DS3","f1":"a"}
+{"f1":{"_t":"uint8","_v":1},"_t":"DS1"}
+{"_t":"[]string","_v":["a"]}
+{"f1":"b"}
+"c"
+{"_t":"DS9"}
+{"_t":"DS3","f1":"d"}
+`
+	dec := json.NewDecoder(strings.NewReader(str))
+	dec.SetDiscriminator("_t", "_v", discriminatorToTypeFn)
+
+	var objs []interface{}
+	for {
+		obj, err := dec.DecodeAny()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var de *json.DiscriminatorError
+			if !errors.As(err, &de) || de.TypeName != "DS9" {
+				t.Fatal(err)
+			}
+			continue
+		}
+		objs = append(objs, obj)
+	}
+
+	assertDeepEqual(t, objs, []interface{}{
+		DS3{F1: "a"},
+		DS1{F1: uint8(1)},
+		[]string{"a"},
+		map[string]interface{}{"f1": "b"},
+		"c",
+		DS3{F1: "d"},
+	})
+}
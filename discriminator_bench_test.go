@@ -0,0 +1,133 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	json "github.com/akutz/gdj"
+)
+
+// discriminatedArrayForBench returns a JSON array of n discriminated
+// objects. If typeNameLast is true then the type name is the last field of
+// each object.
+func discriminatedArrayForBench(n int, typeNameLast bool) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if typeNameLast {
+			fmt.Fprintf(&buf, `{"f1":"%d","_t":"DS3"}`, i)
+		} else {
+			fmt.Fprintf(&buf, `{"_t":"DS3","f1":"%d"}`, i)
+		}
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+// TestDecodeDiscriminatedArrayAllocs asserts the number of allocations made
+// to decode an array of discriminated objects is bounded per element, so it
+// grows linearly with the length of the array.
+func TestDecodeDiscriminatedArrayAllocs(t *testing.T) {
+	const n = 1000
+	for _, tc := range []struct {
+		name         string
+		typeNameLast bool
+		maxPerElem   float64
+	}{
+		{name: "Type name first", maxPerElem: 8},
+		{name: "Type name last", typeNameLast: true, maxPerElem: 16},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			data := discriminatedArrayForBench(n, tc.typeNameLast)
+			var err error
+			allocs := testing.AllocsPerRun(10, func() {
+				var obj []interface{}
+				err = json.UnmarshalWithDiscriminator(
+					data, &obj, "_t", "_v", discriminatorToTypeFn)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := allocs/n, tc.maxPerElem; a > e {
+				t.Errorf("too many allocations per element: e<=%v, a=%v", e, a)
+			}
+		})
+	}
+}
+
+// BenchmarkDecodeDiscriminatedArray decodes arrays of discriminated objects
+// of increasing length. The time spent per element, reported as ns/elem,
+// should remain constant as the length of the array increases.
+func BenchmarkDecodeDiscriminatedArray(b *testing.B) {
+	for _, typeNameLast := range []bool{false, true} {
+		for _, n := range []int{100, 1000, 10000} {
+			typeNameLast, n := typeNameLast, n // capture the range variables
+			name := fmt.Sprintf("type name first/%d", n)
+			if typeNameLast {
+				name = fmt.Sprintf("type name last/%d", n)
+			}
+			b.Run(name, func(b *testing.B) {
+				data := discriminatedArrayForBench(n, typeNameLast)
+				b.SetBytes(int64(len(data)))
+				b.ReportAllocs()
+				b.ResetTimer()
+				start := time.Now()
+
+				for i := 0; i < b.N; i++ {
+					var obj []interface{}
+					if err := json.UnmarshalWithDiscriminator(
+						data, &obj, "_t", "_v", discriminatorToTypeFn); err != nil {
+						b.Fatal(err)
+					}
+					if len(obj) != n {
+						b.Fatalf("len mismatch: e=%d, a=%d", n, len(obj))
+					}
+				}
+
+				b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(b.N*n), "ns/elem")
+			})
+		}
+	}
+}
+
+// BenchmarkEncodeDiscriminatedArray encodes arrays of values stored in
+// interfaces, each of which is encoded with its type name.
+func BenchmarkEncodeDiscriminatedArray(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		obj  interface{}
+	}{
+		{name: "named", obj: DS3{F1: "a"}},
+		{name: "composite", obj: map[string][]int{"a": {1}}},
+	} {
+		tc := tc // capture the loop variable
+		b.Run(tc.name, func(b *testing.B) {
+			obj := make([]interface{}, 1000)
+			for i := range obj {
+				obj[i] = tc.obj
+			}
+			c := json.NewCodec(json.CodecOptions{
+				TypeFieldName:  "_t",
+				ValueFieldName: "_v",
+			})
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Marshal(obj); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
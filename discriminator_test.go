@@ -59,7 +59,7 @@ type DS8 struct {
 	F1 DS3 `json:"f1"`
 }
 
-var discriminatorTests = []struct {
+type discriminatorTest struct {
 	obj       interface{}
 	str       string
 	expObj    interface{}
@@ -70,7 +70,9 @@ var discriminatorTests = []struct {
 	vf        string
 	mode      json.DiscriminatorEncodeMode
 	dd        bool
-}{
+}
+
+var discriminatorTests = []discriminatorTest{
 	// encode/decode nil/null works as expected
 	{obj: nil, str: `null`},
 	{obj: nil, str: `null`, mode: json.DiscriminatorEncodeTypeNameRootValue},
@@ -384,6 +386,59 @@ func TestDiscriminator(t *testing.T) {
 
 	t.Run("Encode", testDiscriminatorEncode)
 	t.Run("Decode", testDiscriminatorDecode)
+	t.Run("Marshal", testDiscriminatorMarshal)
+	t.Run("Unmarshal", testDiscriminatorUnmarshal)
+}
+
+func TestDiscriminatorFieldOrder(t *testing.T) {
+	for _, tc := range []struct {
+		layout json.DiscriminatorLayout
+		str    string
+		obj    DS1
+		err    string
+	}{
+		{str: `{"f1":{"_t":"DS3","f1":"a"}}`, obj: DS1{F1: DS3{F1: "a"}}},
+		{str: `{"f1":{"f1":"a","_t":"DS3"}}`, obj: DS1{F1: DS3{F1: "a"}}},
+		{str: `{"f1": { "_t" : "DS3" , "f1" : "a" } }`, obj: DS1{F1: DS3{F1: "a"}}},
+		{str: `{"f1":{"_t":"DS3"}}`, obj: DS1{F1: DS3{}}},
+		{str: `{"f1":{"_t":"DS4","f1":"a","f2":{"_t":"DS3","f1":"b"}}}`, obj: DS1{F1: DS4{F1: "a", F2: DS3{F1: "b"}}}},
+		{str: `{"f1":{"f1":"a","f2":{"f1":"b","_t":"DS3"},"_t":"DS4"}}`, obj: DS1{F1: DS4{F1: "a", F2: DS3{F1: "b"}}}},
+		{str: `{"f1":{"_t":"mapStringIntNoop"}}`, obj: DS1{F1: mapStringIntNoop{}}},
+		{str: `{"f1":{"_t":"mapStringIntNoop","a":1}}`, obj: DS1{F1: mapStringIntNoop{"a": 1}}},
+		{str: `{"f1":{"a":1,"_t":"mapStringIntNoop"}}`, obj: DS1{F1: mapStringIntNoop{"a": 1}}},
+		{str: `{"f1":{"_t":"uint8","_v":1}}`, obj: DS1{F1: uint8(1)}},
+		{str: `{"f1":{"_v":1,"_t":"uint8"}}`, obj: DS1{F1: uint8(1)}},
+		{str: `{"f1":{"x":[1,{"y":2}],"_t":"uint8","z":"a","_v":1}}`, obj: DS1{F1: uint8(1)}},
+		{layout: json.DiscriminatorLayoutAdjacent, str: `{"f1":{"_t":"DS3","_v":{"f1":"a"}}}`, obj: DS1{F1: DS3{F1: "a"}}},
+		{layout: json.DiscriminatorLayoutAdjacent, str: `{"f1":{"_v":{"f1":"a"},"_t":"DS3"}}`, obj: DS1{F1: DS3{F1: "a"}}},
+		{str: `{"f1":{"_t":"DS3","f1":1}}`, err: `json: cannot unmarshal number into Go struct field DS3.f1.f1 of type string`},
+		{str: `{"f1":{"f1":1,"_t":"DS3"}}`, err: `json: cannot unmarshal number into Go struct field DS3.f1.f1 of type string`},
+		{str: `{"f1":{"f1":"a"}}`, obj: DS1{F1: map[string]interface{}{"f1": "a"}}},
+		{str: `{"f1":{"_t":1}}`, err: `json: discriminator type at offset 12 is not string`},
+		{str: `{"f1":{"_t":"uint8"}}`, err: `json: missing discriminator value at offset 6`},
+	} {
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeFn:         discriminatorToTypeFn,
+			Layout:         tc.layout,
+		})
+		var obj DS1
+		err := c.Unmarshal([]byte(tc.str), &obj)
+		if tc.err != "" {
+			if a, e := err, tc.err; a == nil || a.Error() != e {
+				t.Errorf("%s: expected error mismatch: e=%v, a=%v", tc.str, e, a)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.str, err)
+			continue
+		}
+		if !reflect.DeepEqual(obj, tc.obj) {
+			t.Errorf("%s: mismatch: e=%+v, a=%+v", tc.str, tc.obj, obj)
+		}
+	}
 }
 
 func testDiscriminatorEncode(t *testing.T) {
@@ -417,13 +472,57 @@ func testDiscriminatorEncode(t *testing.T) {
 	}
 }
 
+func testDiscriminatorMarshal(t *testing.T) {
+	for _, tc := range discriminatorTests {
+		tc := tc // caputre the loop variable
+		t.Run("", func(t *testing.T) {
+			ee := tc.expEncErr
+
+			data, err := json.MarshalWithDiscriminator(tc.obj, tc.tf, tc.vf, tc.mode)
+			if err != nil {
+				if ee != err.Error() {
+					t.Errorf("expected error mismatch: e=%v, a=%v", ee, err)
+				} else if ee == "" {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if ee != "" {
+				t.Errorf("expected error did not occur: %v", ee)
+			} else {
+				a, e := string(data), tc.str
+				if tc.expStr != "" {
+					e = tc.expStr
+				}
+				if a != e {
+					t.Errorf("mismatch: e=%s, a=%s", e, a)
+				}
+			}
+		})
+	}
+}
+
 func testDiscriminatorDecode(t *testing.T) {
+	testDiscriminatorDecodeWith(t, func(tc discriminatorTest, v interface{}) error {
+		dec := json.NewDecoder(strings.NewReader(tc.str))
+		dec.SetDiscriminator(tc.tf, tc.vf, discriminatorToTypeFn)
+		return dec.Decode(v)
+	})
+}
+
+func testDiscriminatorUnmarshal(t *testing.T) {
+	testDiscriminatorDecodeWith(t, func(tc discriminatorTest, v interface{}) error {
+		return json.UnmarshalWithDiscriminator(
+			[]byte(tc.str), v, tc.tf, tc.vf, discriminatorToTypeFn)
+	})
+}
+
+func testDiscriminatorDecodeWith(
+	t *testing.T,
+	decode func(tc discriminatorTest, v interface{}) error) {
+
 	for _, tc := range discriminatorTests {
 		tc := tc // caputre the loop variable
 		t.Run("", func(t *testing.T) {
 			ee := tc.expDecErr
-			dec := json.NewDecoder(strings.NewReader(tc.str))
-			dec.SetDiscriminator(tc.tf, tc.vf, discriminatorToTypeFn)
 
 			var (
 				err error
@@ -431,43 +530,43 @@ func testDiscriminatorDecode(t *testing.T) {
 			)
 
 			if tc.obj == nil || tc.mode&json.DiscriminatorEncodeTypeNameRootValue > 0 {
-				err = dec.Decode(&obj)
+				err = decode(tc, &obj)
 			} else {
 				switch reflect.TypeOf(tc.obj).Name() {
 				case "DS1":
 					var o DS1
-					err = dec.Decode(&o)
+					err = decode(tc, &o)
 					obj = o
 				case "DS2":
 					var o DS2
-					err = dec.Decode(&o)
+					err = decode(tc, &o)
 					obj = o
 				case "DS3":
 					var o DS3
-					err = dec.Decode(&o)
+					err = decode(tc, &o)
 					obj = o
 				case "DS4":
 					var o DS4
-					err = dec.Decode(&o)
+					err = decode(tc, &o)
 					obj = o
 				case "DS5":
 					var o DS5
-					err = dec.Decode(&o)
+					err = decode(tc, &o)
 					obj = o
 				case "DS6":
 					var o DS6
-					err = dec.Decode(&o)
+					err = decode(tc, &o)
 					obj = o
 				case "DS7":
 					var o DS7
-					err = dec.Decode(&o)
+					err = decode(tc, &o)
 					obj = o
 				case "DS8":
 					var o DS8
-					err = dec.Decode(&o)
+					err = decode(tc, &o)
 					obj = o
 				default:
-					err = dec.Decode(&obj)
+					err = decode(tc, &obj)
 				}
 			}
 
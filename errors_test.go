@@ -0,0 +1,139 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+func TestDiscriminatorError(t *testing.T) {
+	emptyIfaceType := reflect.TypeOf((*interface{})(nil)).Elem()
+
+	for _, tc := range []struct {
+		layout json.DiscriminatorLayout
+		str    string
+		obj    interface{}
+		err    json.DiscriminatorError
+		msg    string
+	}{
+		{
+			str: `{"f1":{"_t":1}}`,
+			obj: &DS1{},
+			err: json.DiscriminatorError{Reason: "discriminator type is not string", Offset: 12, Path: "/f1", Type: emptyIfaceType},
+			msg: `json: discriminator type at offset 12 is not string`,
+		},
+		{
+			str: `{"f1":{"_t":""}}`,
+			obj: &DS1{},
+			err: json.DiscriminatorError{Reason: "discriminator type is empty", Offset: 12, Path: "/f1", Type: emptyIfaceType},
+			msg: `json: discriminator type at offset 12 is empty`,
+		},
+		{
+			str: `{"a":[{"b":1},{"a/b~c":{"_t":"DS9"}}]}`,
+			obj: new(interface{}),
+			err: json.DiscriminatorError{TypeName: "DS9", Reason: "unknown discriminator type", Offset: 23, Path: "/a/1/a~1b~0c", Type: emptyIfaceType},
+			msg: `json: invalid discriminator type: DS9`,
+		},
+		{
+			str: `{"f1":{"_t":"uint8"}}`,
+			obj: &DS1{},
+			err: json.DiscriminatorError{TypeName: "uint8", Reason: "missing discriminator value", Offset: 6, Path: "/f1", Type: emptyIfaceType},
+			msg: `json: missing discriminator value at offset 6`,
+		},
+		{
+			str: `{"f1":{"_t":"complex64","_v":1}}`,
+			obj: &DS1{},
+			err: json.DiscriminatorError{TypeName: "complex64", Reason: "unsupported discriminator type", Offset: 6, Path: "/f1", Type: emptyIfaceType},
+			msg: `json: unsupported discriminator type: complex64`,
+		},
+		{
+			str: `{"f1":{"f1":"a"}}`,
+			obj: &DS2{},
+			err: json.DiscriminatorError{Reason: "missing discriminator", Offset: 6, Path: "/f1", Type: reflect.TypeOf((*noop1)(nil)).Elem()},
+			msg: `json: missing discriminator`,
+		},
+		{
+			str: `[{"_t":"DS4","f1":"a","f2":{"_t":"uint8"}}]`,
+			obj: &[]interface{}{},
+			err: json.DiscriminatorError{TypeName: "uint8", Reason: "missing discriminator value", Offset: 27, Path: "/0/f2", Type: emptyIfaceType},
+			msg: `json: missing discriminator value at offset 27`,
+		},
+		{
+			layout: json.DiscriminatorLayoutTuple,
+			str:    `{"f1":["DS3",{},1]}`,
+			obj:    &DS1{},
+			err:    json.DiscriminatorError{TypeName: "DS3", Reason: "discriminated array has more than two elements", Offset: 7, Path: "/f1", Type: emptyIfaceType},
+			msg:    `json: discriminated array at offset 7 has more than two elements`,
+		},
+		{
+			layout: json.DiscriminatorLayoutExternal,
+			str:    `{"f1":{"DS3":{},"DS4":{}}}`,
+			obj:    &DS1{},
+			err:    json.DiscriminatorError{TypeName: "DS3", Reason: "externally discriminated object has more than one field", Offset: 7, Path: "/f1", Type: emptyIfaceType},
+			msg:    `json: externally discriminated object at offset 7 has more than one field`,
+		},
+	} {
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeFn:         discriminatorToTypeFn,
+			Layout:         tc.layout,
+		})
+		err := c.Unmarshal([]byte(tc.str), tc.obj)
+		var de *json.DiscriminatorError
+		if !errors.As(err, &de) {
+			t.Errorf("%s: expected DiscriminatorError: a=%v", tc.str, err)
+			continue
+		}
+		if a, e := de.Error(), tc.msg; a != e {
+			t.Errorf("%s: message mismatch: e=%s, a=%s", tc.str, e, a)
+		}
+		a, e := *de, tc.err
+		a.Err = nil
+		if a.TypeName != e.TypeName || a.Reason != e.Reason ||
+			a.Offset != e.Offset || a.Path != e.Path || a.Type != e.Type {
+			t.Errorf("%s: mismatch: e=%+v, a=%+v", tc.str, e, a)
+		}
+	}
+
+	t.Run("Unwrap", func(t *testing.T) {
+		err := json.UnmarshalWithDiscriminator(
+			[]byte(`{"f1":{"_t":"DS9"}}`), &DS1{}, "_t", "_v", discriminatorToTypeFn)
+		var de *json.DiscriminatorError
+		if !errors.As(err, &de) {
+			t.Fatalf("expected DiscriminatorError: a=%v", err)
+		}
+		if de.Err == nil || errors.Unwrap(de) != de.Err {
+			t.Errorf("expected underlying error: a=%v", de.Err)
+		}
+	})
+
+	t.Run("Nested type error", func(t *testing.T) {
+		for _, str := range []string{
+			`[1,{"_t":"DS4","f1":"a","f2":{"f1":2,"_t":"DS3"}}]`,
+			`[1,{"f1":"a","f2":{"f1":2,"_t":"DS3"},"_t":"DS4"}]`,
+		} {
+			var obj []interface{}
+			err := json.UnmarshalWithDiscriminator(
+				[]byte(str), &obj, "_t", "_v", discriminatorToTypeFn)
+			var ute *json.UnmarshalTypeError
+			if !errors.As(err, &ute) {
+				t.Errorf("%s: expected UnmarshalTypeError: a=%v", str, err)
+				continue
+			}
+			if a, e := ute.Field, "f2.f1"; a != e {
+				t.Errorf("%s: field mismatch: e=%s, a=%s", str, e, a)
+			}
+			if a, e := ute.Offset, int64(strings.Index(str, `"f1":2`)+len(`"f1":2`)); a != e {
+				t.Errorf("%s: offset mismatch: e=%d, a=%d", str, e, a)
+			}
+		}
+	})
+}
@@ -154,3 +154,39 @@ func ExampleNewDecoder_empty_interface() {
 	// uint8(42)
 	// string(Andrew)
 }
+
+func ExampleMarshalWithDiscriminator() {
+	data, err := json.MarshalWithDiscriminator(
+		Person{"Andrew", []interface{}{"Austin", uint8(42)}},
+		"type", "value", 0)
+	if err != nil {
+		fmt.Println("error:", err)
+	}
+	fmt.Println(string(data))
+	// Output:
+	// {"name":"Andrew","attributes":[{"type":"string","value":"Austin"},{"type":"uint8","value":42}]}
+}
+
+func ExampleUnmarshalWithDiscriminator() {
+	var jsonBlob = []byte(`{
+		"name":"Mandy",
+		"attributes":[
+			{"type":"Spouse", "name": "Andrew"}
+		]
+	}`)
+
+	var p Person
+	if err := json.UnmarshalWithDiscriminator(
+		jsonBlob, &p, "type", "value",
+		func(s string) (reflect.Type, bool) {
+			if s == "Spouse" {
+				return reflect.TypeOf(Spouse{}), true
+			}
+			return nil, false
+		}); err != nil {
+		fmt.Println("error:", err)
+	}
+	fmt.Printf("%[1]T(%[1]s)\n", p.Attributes[0].(Spouse).Name)
+	// Output:
+	// string(Andrew)
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"reflect"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+type fieldTagOwner struct {
+	Pet   animal         `json:"pet,discriminator=kind"`
+	Pets  []animal       `json:"pets,discriminator=kind"`
+	Home  DS3            `json:"home,typed"`
+	Homes map[string]int `json:"homes,typed,discriminator=kind"`
+	Doc   interface{}    `json:"doc,untyped"`
+	Other interface{}    `json:"other"`
+}
+
+func TestFieldTagDiscriminator(t *testing.T) {
+	r := json.NewTypeRegistry()
+	for _, obj := range []interface{}{animalDog{}, animalFish(0), DS3{}} {
+		if err := r.Register(reflect.TypeOf(obj), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		mode json.DiscriminatorEncodeMode
+		obj  interface{}
+		str  string
+	}{
+		{
+			name: "field options",
+			obj: fieldTagOwner{
+				Pet:   animalDog{Name: "a"},
+				Pets:  []animal{animalFish(1), animalDog{Name: "b"}},
+				Home:  DS3{F1: "x"},
+				Homes: map[string]int{"a": 1},
+				Doc:   map[string]interface{}{"a": map[string]interface{}{"b": 1.0}},
+				Other: DS3{F1: "y"},
+			},
+			str: `{"pet":{"kind":"animalDog","name":"a"},"pets":[{"kind":"animalFish","_v":1},{"kind":"animalDog","name":"b"}],"home":{"_t":"DS3","f1":"x"},"homes":{"kind":"map[string]int","a":1},"doc":{"a":{"b":1}},"other":{"_t":"DS3","f1":"y"}}`,
+		},
+		{
+			name: "untyped with all objects",
+			mode: json.DiscriminatorEncodeTypeNameAllObjects,
+			obj: fieldTagOwner{
+				Home:  DS3{F1: "x"},
+				Homes: map[string]int{},
+				Doc:   DS1{F1: map[string]interface{}{"a": 1.0}},
+			},
+			str: `{"_t":"fieldTagOwner","pet":null,"pets":null,"home":{"_t":"DS3","f1":"x"},"homes":{"kind":"map[string]int"},"doc":{"f1":{"a":1}},"other":null}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := json.NewCodec(json.CodecOptions{
+				TypeFieldName:  "_t",
+				ValueFieldName: "_v",
+				EncodeMode:     tc.mode,
+				TypeRegistry:   r,
+			})
+			data, err := c.Marshal(tc.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := string(data), tc.str; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			var obj fieldTagOwner
+			if err := c.Unmarshal(data, &obj); err != nil {
+				t.Fatal(err)
+			}
+			exp := tc.obj.(fieldTagOwner)
+			if ds1, ok := exp.Doc.(DS1); ok {
+				// An untyped value is decoded as if there is no discriminator.
+				exp.Doc = map[string]interface{}{"f1": ds1.F1}
+			}
+			assertDeepEqual(t, obj, exp)
+		})
+	}
+}
@@ -0,0 +1,33 @@
+//go:build go1.18
+
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import "reflect"
+
+// RegisterType registers the type T with the registry r using the provided
+// name and optional aliases. Please see TypeRegistry.Register for more
+// information.
+func RegisterType[T any](r *TypeRegistry, name string, aliases ...string) error {
+	return r.Register(reflect.TypeOf((*T)(nil)).Elem(), name, aliases...)
+}
+
+// RegisterInterface registers the discriminator used to encode and decode
+// the values stored in the interface type I. Please see
+// TypeRegistry.RegisterInterface for more information.
+func RegisterInterface[I any](r *TypeRegistry, d InterfaceDiscriminator) error {
+	return r.RegisterInterface(reflect.TypeOf((*I)(nil)).Elem(), d)
+}
+
+// DecodeAs reads the next JSON-encoded value from dec and returns it as a
+// value of the type I. If I is an interface then the value is a new value
+// of the Go type named by its discriminator, including the discriminator
+// registered for I with RegisterInterface, if any.
+func DecodeAs[I any](dec *Decoder) (I, error) {
+	var v I
+	err := dec.Decode(&v)
+	return v, err
+}
@@ -0,0 +1,183 @@
+//go:build go1.18
+
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+func TestRegisterType(t *testing.T) {
+	r := json.NewTypeRegistry()
+	if err := json.RegisterType[DS3](r, "ds3", "DS3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.RegisterType[noop1](r, "noop1"); err != nil {
+		t.Fatal(err)
+	}
+	for name, typ := range map[string]reflect.Type{
+		"ds3":   reflect.TypeOf(DS3{}),
+		"DS3":   reflect.TypeOf(DS3{}),
+		"noop1": reflect.TypeOf((*noop1)(nil)).Elem(),
+	} {
+		if a, ok := r.TypeOf(name); !ok || a != typ {
+			t.Errorf("TypeOf(%q) mismatch: e=%v, a=%v", name, typ, a)
+		}
+	}
+}
+
+func TestRegisterInterface(t *testing.T) {
+	r := json.NewTypeRegistry()
+	if err := json.RegisterInterface[animal](r, json.InterfaceDiscriminator{
+		TypeFieldName:  "kind",
+		ValueFieldName: "value",
+		AllowedTypes:   []reflect.Type{reflect.TypeOf(animalDog{})},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.RegisterType[animalDog](r, "dog"); err != nil {
+		t.Fatal(err)
+	}
+	c := json.NewCodec(json.CodecOptions{TypeRegistry: r})
+	data, err := c.Marshal(animalOwner{Pet: animalDog{Name: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, e := string(data), `{"pet":{"kind":"dog","name":"a"}}`; a != e {
+		t.Errorf("mismatch: e=%s, a=%s", e, a)
+	}
+}
+
+type genericBox[T any] struct {
+	V T `json:"v"`
+}
+
+type genericPair[K, V any] struct {
+	K K `json:"k"`
+	V V `json:"v"`
+}
+
+type genericKey[T any] string
+
+func TestGenericTypeNames(t *testing.T) {
+	r := json.NewTypeRegistry()
+	if err := json.RegisterType[genericBox[int]](r, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.RegisterType[genericPair[string, DS3]](r, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.RegisterType[genericBox[[]genericBox[*DS3]]](r, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.RegisterType[genericKey[int]](r, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.RegisterType[genericPair[map[string][]int, *genericBox[int]]](r, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		mode json.DiscriminatorEncodeMode
+		obj  interface{}
+		str  string
+	}{
+		{
+			name: "short",
+			obj:  DS1{F1: genericBox[int]{V: 1}},
+			str:  `{"f1":{"_t":"genericBox[int]","v":1}}`,
+		},
+		{
+			name: "short with qualified type argument",
+			obj:  DS1{F1: genericPair[string, DS3]{K: "a", V: DS3{F1: "b"}}},
+			str:  `{"f1":{"_t":"genericPair[string,DS3]","k":"a","v":{"f1":"b"}}}`,
+		},
+		{
+			name: "short with nested type arguments",
+			obj:  DS1{F1: genericBox[[]genericBox[*DS3]]{V: []genericBox[*DS3]{{V: &DS3{F1: "a"}}}}},
+			str:  `{"f1":{"_t":"genericBox[[]genericBox[*DS3]]","v":[{"v":{"f1":"a"}}]}}`,
+		},
+		{
+			name: "composite type arguments",
+			obj:  DS1{F1: []genericPair[map[string][]int, *genericBox[int]]{{K: map[string][]int{"a": {1}}, V: &genericBox[int]{V: 2}}}},
+			str:  `{"f1":{"_t":"[]genericPair[map[string][]int,*genericBox[int]]","_v":[{"k":{"a":[1]},"v":{"v":2}}]}}`,
+		},
+		{
+			name: "type arguments with path",
+			mode: json.DiscriminatorEncodeTypeNameTypeArgsWithPath,
+			obj:  DS1{F1: genericPair[string, DS3]{K: "a", V: DS3{F1: "b"}}},
+			str:  `{"f1":{"_t":"genericPair[string,github.com/akutz/gdj_test.DS3]","k":"a","v":{"f1":"b"}}}`,
+		},
+		{
+			name: "with path",
+			mode: json.DiscriminatorEncodeTypeNameWithPath,
+			obj:  DS1{F1: genericPair[string, DS3]{K: "a", V: DS3{F1: "b"}}},
+			str:  `{"f1":{"_t":"github.com/akutz/gdj_test.genericPair[string,github.com/akutz/gdj_test.DS3]","k":"a","v":{"f1":"b"}}}`,
+		},
+		{
+			name: "slice",
+			obj:  DS1{F1: []genericBox[int]{{V: 1}}},
+			str:  `{"f1":{"_t":"[]genericBox[int]","_v":[{"v":1}]}}`,
+		},
+		{
+			name: "map",
+			obj:  DS1{F1: map[genericKey[int]]genericBox[int]{"a": {V: 1}}},
+			str:  `{"f1":{"_t":"map[genericKey[int]]genericBox[int]","a":{"v":1}}}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// The registry is used only to decode the type names since the
+			// encoder prefers the names of registered types.
+			c := json.NewCodec(json.CodecOptions{
+				TypeFieldName:  "_t",
+				ValueFieldName: "_v",
+				EncodeMode:     tc.mode,
+				TypeRegistry:   r,
+			})
+			data, err := json.MarshalWithDiscriminator(tc.obj, "_t", "_v", tc.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := string(data), tc.str; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			obj := reflect.New(reflect.TypeOf(tc.obj))
+			if err := c.Unmarshal(data, obj.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			assertDeepEqual(t, obj.Elem().Interface(), tc.obj)
+		})
+	}
+}
+
+func TestDecodeAs(t *testing.T) {
+	str := `{"kind":"dog","name":"a"} {"kind":"cat","name":"b"} {"kind":"fish","value":1}`
+	dec := json.NewDecoder(strings.NewReader(str))
+	dec.SetTypeRegistry(newAnimalRegistryForTests(t))
+
+	var pets []animal
+	for dec.More() {
+		pet, err := json.DecodeAs[animal](dec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pets = append(pets, pet)
+	}
+	assertDeepEqual(t, pets, []animal{animalDog{Name: "a"}, &animalCat{Name: "b"}, animalFish(1)})
+
+	dec = json.NewDecoder(strings.NewReader(`{"_t":"DS3","f1":"a"}`))
+	dec.SetDiscriminator("_t", "_v", discriminatorToTypeFn)
+	obj, err := json.DecodeAs[interface{}](dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertDeepEqual(t, obj, DS3{F1: "a"})
+}
@@ -0,0 +1,186 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"bytes"
+	"io"
+)
+
+// CodecOptions describes the options used by a Codec to encode and decode
+// values.
+type CodecOptions struct {
+	// TypeFieldName is the name of the field used to encode a value's Go
+	// type. Please see Encoder.SetDiscriminator for more information.
+	TypeFieldName string
+
+	// ValueFieldName is the name of the field used to encode a value that is
+	// not a map or struct. Please see Encoder.SetDiscriminator for more
+	// information.
+	ValueFieldName string
+
+	// EncodeMode is a mask that controls the encoder's behavior when the
+	// discriminator is set.
+	EncodeMode DiscriminatorEncodeMode
+
+	// TypeFn is an optional function used to look up custom types by their
+	// type names when decoding.
+	TypeFn DiscriminatorToTypeFunc
+
+	// TypeRegistry is an optional registry used to look up type names when
+	// encoding and types when decoding.
+	TypeRegistry *TypeRegistry
+
+	// TypeNameFn is an optional function used to get the type names of
+	// values when encoding. Please see Encoder.SetTypeNameFunc for more
+	// information.
+	TypeNameFn TypeToDiscriminatorFunc
+
+	// Layout describes where the type name is encoded relative to a value
+	// stored in an interface. Please see Encoder.SetDiscriminatorLayout for
+	// more information.
+	Layout DiscriminatorLayout
+
+	// UnknownTypeFn is an optional function used to get the value stored in
+	// an interface when a type name cannot be resolved to a Go type. Please
+	// see Decoder.SetUnknownTypeFunc for more information.
+	UnknownTypeFn UnknownTypeFunc
+
+	// DisableHTMLEscape disables escaping problematic HTML characters inside
+	// JSON quoted strings. Please see Encoder.SetEscapeHTML for more
+	// information.
+	DisableHTMLEscape bool
+
+	// IndentPrefix and Indent cause encoded values to be formatted as if by
+	// the package-level function Indent(dst, src, IndentPrefix, Indent).
+	IndentPrefix string
+	Indent       string
+
+	// UseNumber causes numbers to be decoded into an interface{} as a Number
+	// instead of as a float64.
+	UseNumber bool
+
+	// DisallowUnknownFields causes an error to be returned when the
+	// destination is a struct and the input contains object keys which do
+	// not match any non-ignored, exported fields in the destination.
+	DisallowUnknownFields bool
+
+	// DisallowTypeNameMismatch causes an error to be returned when a JSON
+	// object decoded into a map or struct has a type name that does not
+	// match the map or struct type. Please see
+	// Decoder.DisallowTypeNameMismatch for more information.
+	DisallowTypeNameMismatch bool
+
+	// DecodePolicy limits the resources used to decode untrusted input.
+	// Please see DecodePolicy for more information.
+	DecodePolicy DecodePolicy
+
+	// nested is set for the options given to a MarshalerWithOptions, since
+	// the value it encodes is not the root value.
+	nested bool
+}
+
+// A Codec encodes and decodes JSON values using a fixed set of options so
+// the same wire convention may be defined once and shared by callers.
+// A Codec is immutable and safe for concurrent use by multiple goroutines.
+type Codec struct {
+	opts CodecOptions
+}
+
+// NewCodec returns a new Codec that uses the provided options.
+func NewCodec(opts CodecOptions) *Codec {
+	return &Codec{opts: opts}
+}
+
+// Options returns a copy of the options used by the codec.
+func (c *Codec) Options() CodecOptions {
+	return c.opts
+}
+
+// Marshal returns the JSON encoding of v using the codec's options.
+func (c *Codec) Marshal(v interface{}) ([]byte, error) {
+	e := newEncodeState()
+	defer encodeStatePool.Put(e)
+
+	if err := e.marshal(v, c.encOpts()); err != nil {
+		return nil, err
+	}
+	if c.opts.IndentPrefix == "" && c.opts.Indent == "" {
+		return append([]byte(nil), e.Bytes()...), nil
+	}
+	var buf bytes.Buffer
+	if err := Indent(&buf, e.Bytes(), c.opts.IndentPrefix, c.opts.Indent); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal parses the JSON-encoded data using the codec's options and
+// stores the result in the value pointed to by v.
+func (c *Codec) Unmarshal(data []byte, v interface{}) error {
+	// Check for well-formedness.
+	// Avoids filling out half a data structure
+	// before discovering a JSON syntax error.
+	var d decodeState
+	err := c.opts.DecodePolicy.checkValid(data, &d.scan)
+	if err != nil {
+		return setErrorPosition(err, data, 0, 1, 1)
+	}
+
+	d.init(data)
+	c.initDecodeState(&d)
+	return setErrorPosition(d.unmarshal(v), data, 0, 1, 1)
+}
+
+// NewEncoder returns a new encoder that writes to w using the codec's
+// options.
+func (c *Codec) NewEncoder(w io.Writer) *Encoder {
+	enc := NewEncoder(w)
+	enc.SetEscapeHTML(!c.opts.DisableHTMLEscape)
+	enc.SetIndent(c.opts.IndentPrefix, c.opts.Indent)
+	enc.SetDiscriminator(
+		c.opts.TypeFieldName,
+		c.opts.ValueFieldName,
+		c.opts.EncodeMode)
+	enc.SetTypeRegistry(c.opts.TypeRegistry)
+	enc.SetTypeNameFunc(c.opts.TypeNameFn)
+	enc.SetDiscriminatorLayout(c.opts.Layout)
+	return enc
+}
+
+// NewDecoder returns a new decoder that reads from r using the codec's
+// options.
+func (c *Codec) NewDecoder(r io.Reader) *Decoder {
+	dec := NewDecoder(r)
+	c.initDecodeState(&dec.d)
+	dec.SetDecodePolicy(c.opts.DecodePolicy)
+	return dec
+}
+
+func (c *Codec) encOpts() encOpts {
+	return encOpts{
+		escapeHTML:                  !c.opts.DisableHTMLEscape,
+		discriminatorTypeFieldName:  c.opts.TypeFieldName,
+		discriminatorValueFieldName: c.opts.ValueFieldName,
+		discriminatorEncodeMode:     c.opts.EncodeMode,
+		discriminatorTypeRegistry:   c.opts.TypeRegistry,
+		discriminatorTypeNameFn:     c.opts.TypeNameFn,
+		discriminatorLayout:         c.opts.Layout,
+		discriminatorNested:         c.opts.nested,
+	}
+}
+
+func (c *Codec) initDecodeState(d *decodeState) {
+	d.useNumber = c.opts.UseNumber
+	d.disallowUnknownFields = c.opts.DisallowUnknownFields
+	d.discriminatorTypeFieldName = c.opts.TypeFieldName
+	d.discriminatorValueFieldName = c.opts.ValueFieldName
+	d.discriminatorToTypeFn = c.opts.TypeFn
+	d.discriminatorTypeRegistry = c.opts.TypeRegistry
+	d.discriminatorLayout = c.opts.Layout
+	d.discriminatorUnknownTypeFn = c.opts.UnknownTypeFn
+	d.disallowTypeNameMismatch = c.opts.DisallowTypeNameMismatch
+	d.decodePolicy = c.opts.DecodePolicy
+}
@@ -301,6 +301,18 @@ type encodeState struct {
 	// to false as soon as the type name is encoded to prevent impacting
 	// subsequent values.
 	discriminatorEncodeTypeName bool
+	// discriminatorTypeFieldName and discriminatorTypeName are the field
+	// name and type name encoded when discriminatorEncodeTypeName is true.
+	discriminatorTypeFieldName string
+	discriminatorTypeName      string
+	// discriminatorValueFieldName is the value field name of the interface
+	// in which a map is stored when discriminatorEncodeTypeName is true.
+	discriminatorValueFieldName string
+	// discriminatorOmitTypeName is set to true when the type name should not
+	// be encoded for the map or struct value at the root of a value encoded
+	// by a MarshalerWithOptions. The flag is flipped back to false as soon as
+	// the map or struct is encoded.
+	discriminatorOmitTypeName bool
 }
 
 const startDetectingCyclesAfter = 1000
@@ -316,6 +328,8 @@ func newEncodeState() *encodeState {
 		}
 		e.ptrLevel = 0
 		e.discriminatorEncodeTypeName = false
+		e.discriminatorValueFieldName = ""
+		e.discriminatorOmitTypeName = false
 		return e
 	}
 	return &encodeState{ptrSeen: make(map[interface{}]struct{})}
@@ -340,8 +354,15 @@ func (e *encodeState) marshal(v interface{}, opts encOpts) (err error) {
 	}()
 
 	val := reflect.ValueOf(v)
-	if val.IsValid() && opts.isDiscriminatorSet() && opts.discriminatorEncodeMode.root() {
-		val = val.Convert(interfaceType)
+	if val.IsValid() && opts.isDiscriminatorSet() {
+		if opts.discriminatorNested {
+			// The value is encoded inside the value of a type that marshals
+			// itself, ex. as an alias of the type, so it is not the root value
+			// and the name of the alias is not encoded.
+			e.discriminatorOmitTypeName = discriminatorIsObjectType(val.Type())
+		} else if opts.discriminatorEncodeMode.root() {
+			val = val.Convert(interfaceType)
+		}
 	}
 	e.reflectValue(val, opts)
 
@@ -388,6 +409,20 @@ type encOpts struct {
 	discriminatorValueFieldName string
 	// see Encoder.SetDiscriminator
 	discriminatorEncodeMode DiscriminatorEncodeMode
+	// see Encoder.SetTypeRegistry
+	discriminatorTypeRegistry *TypeRegistry
+	// see Encoder.SetTypeNameFunc
+	discriminatorTypeNameFn TypeToDiscriminatorFunc
+	// see Encoder.SetDiscriminatorLayout
+	discriminatorLayout DiscriminatorLayout
+	// see InterfaceDiscriminator.Types
+	discriminatorInterfaceTypes *TypeRegistry
+	// discriminatorField holds the discriminator options of the struct
+	// field being encoded.
+	discriminatorField fieldDiscriminator
+	// discriminatorNested is set when the value is encoded by a
+	// MarshalerWithOptions.
+	discriminatorNested bool
 }
 
 type encoderFunc func(e *encodeState, v reflect.Value, opts encOpts)
@@ -442,6 +477,12 @@ func newTypeEncoder(t reflect.Type, allowAddr bool) encoderFunc {
 	// Marshaler with a value receiver, then we're better off taking
 	// the address of the value - otherwise we end up with an
 	// allocation as we cast the value to an interface.
+	if t.Kind() != reflect.Ptr && allowAddr && reflect.PtrTo(t).Implements(optionsMarshalerType) {
+		return newCondAddrEncoder(addrOptionsMarshalerEncoder, newTypeEncoder(t, false))
+	}
+	if t.Implements(optionsMarshalerType) {
+		return optionsMarshalerEncoder
+	}
 	if t.Kind() != reflect.Ptr && allowAddr && reflect.PtrTo(t).Implements(marshalerType) {
 		return newCondAddrEncoder(addrMarshalerEncoder, newTypeEncoder(t, false))
 	}
@@ -736,8 +777,8 @@ func interfaceEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 		e.WriteString("null")
 		return
 	}
-	if opts.isDiscriminatorSet() {
-		discriminatorInterfaceEncode(e, v, opts)
+	if do, ok := opts.discriminatorFor(v.Type()); ok {
+		discriminatorInterfaceEncode(e, v, opts, do)
 		return
 	}
 	e.reflectValue(v.Elem(), opts)
@@ -758,7 +799,7 @@ type structFields struct {
 
 func (se structEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
 	next := byte('{')
-	if opts.isDiscriminatorSet() {
+	if e.isDiscriminatorObject(opts) {
 		next = discriminatorStructEncode(e, v, opts)
 	}
 FieldLoop:
@@ -788,6 +829,11 @@ FieldLoop:
 			e.WriteString(f.nameNonEsc)
 		}
 		opts.quoted = f.quoted
+		opts.discriminatorField = f.discriminator
+		if f.discriminator.untyped {
+			f.encoder(e, fv, opts.withoutDiscriminator())
+			continue
+		}
 
 		f.encoder(e, fv, opts)
 	}
@@ -824,8 +870,10 @@ func (me mapEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
 	}
 	e.WriteByte('{')
 
-	if opts.isDiscriminatorSet() {
-		discriminatorMapEncode(e, v, opts)
+	var typeFieldName, valueFieldName string
+	if e.isDiscriminatorObject(opts) {
+		typeFieldName, valueFieldName = discriminatorMapEncode(e, v, opts)
+		opts.discriminatorField = fieldDiscriminator{}
 	}
 
 	// Extract and sort the keys.
@@ -837,6 +885,10 @@ func (me mapEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
 		if err := sv[i].resolve(); err != nil {
 			e.error(fmt.Errorf("json: encoding error for type %q: %q", v.Type().String(), err.Error()))
 		}
+		if typeFieldName != "" && isDiscriminatorKey(sv[i].ks, typeFieldName) ||
+			valueFieldName != "" && isDiscriminatorKey(sv[i].ks, valueFieldName) {
+			sv[i].ks = discriminatorKeyPrefix + sv[i].ks
+		}
 	}
 	sort.Slice(sv, func(i, j int) bool { return sv[i].ks < sv[j].ks })
 
@@ -929,7 +981,7 @@ func newSliceEncoder(t reflect.Type) encoderFunc {
 	// Byte slices get special treatment; arrays don't.
 	if t.Elem().Kind() == reflect.Uint8 {
 		p := reflect.PtrTo(t.Elem())
-		if !p.Implements(marshalerType) && !p.Implements(textMarshalerType) {
+		if !p.Implements(marshalerType) && !p.Implements(optionsMarshalerType) && !p.Implements(textMarshalerType) {
 			return encodeByteSlice
 		}
 	}
@@ -1221,6 +1273,8 @@ type field struct {
 	omitEmpty bool
 	quoted    bool
 
+	discriminator fieldDiscriminator
+
 	encoder encoderFunc
 }
 
@@ -1335,6 +1389,8 @@ func typeFields(t reflect.Type) structFields {
 						typ:       ft,
 						omitEmpty: opts.Contains("omitempty"),
 						quoted:    quoted,
+
+						discriminator: parseFieldDiscriminator(opts),
 					}
 					field.nameBytes = []byte(field.name)
 					field.equalFold = foldFunc(field.nameBytes)
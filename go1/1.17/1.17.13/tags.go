@@ -42,3 +42,21 @@ func (o tagOptions) Contains(optionName string) bool {
 	}
 	return false
 }
+
+// Value returns the value of a comma-separated list of options' name=value
+// option, ex. "kind" for the "discriminator" option in "discriminator=kind".
+func (o tagOptions) Value(optionName string) (string, bool) {
+	s := string(o)
+	for s != "" {
+		var next string
+		i := strings.Index(s, ",")
+		if i >= 0 {
+			s, next = s[:i], s[i+1:]
+		}
+		if i := strings.Index(s, "="); i >= 0 && s[:i] == optionName {
+			return s[i+1:], true
+		}
+		s = next
+	}
+	return "", false
+}
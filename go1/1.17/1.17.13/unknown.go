@@ -0,0 +1,94 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// UnknownTypeFunc is used to get the value stored in an interface when the
+// type name of a discriminated JSON value cannot be resolved to a Go type.
+// The data is the entire discriminated JSON value, including the type name.
+// If the returned value cannot be stored in the interface then the decoder
+// returns the error for the unknown type name instead.
+type UnknownTypeFunc func(typeName string, data RawMessage) (interface{}, error)
+
+// UnknownDiscriminated is a placeholder for a discriminated JSON value with
+// a type name that cannot be resolved to a Go type. When stored in an
+// interface it is encoded exactly as the original JSON value, so values of
+// unknown types may be decoded and encoded again without being changed.
+type UnknownDiscriminated struct {
+	// TypeName is the type name that could not be resolved.
+	TypeName string
+
+	// Raw is the entire discriminated JSON value, including the type name.
+	Raw RawMessage
+}
+
+// MarshalJSON returns u.Raw as the JSON encoding of u.
+func (u UnknownDiscriminated) MarshalJSON() ([]byte, error) {
+	if u.Raw == nil {
+		return []byte("null"), nil
+	}
+	return u.Raw, nil
+}
+
+// NewUnknownDiscriminated is an UnknownTypeFunc that returns an
+// UnknownDiscriminated placeholder for the JSON value.
+func NewUnknownDiscriminated(typeName string, data RawMessage) (interface{}, error) {
+	return UnknownDiscriminated{TypeName: typeName, Raw: data}, nil
+}
+
+var unknownDiscriminatedType = reflect.TypeOf(UnknownDiscriminated{})
+
+// discriminatorUnknownValue returns the value returned by the decoder's
+// UnknownTypeFunc for the discriminated JSON value with the type name tn.
+// The JSON value begins at the offset start, and the rest of the JSON object
+// or array in which the type name was read is skipped.
+// The error err is returned if it is not for an unknown type name, if there
+// is no UnknownTypeFunc, or if the value returned by the UnknownTypeFunc
+// cannot be stored in the interface.
+func (d *decodeState) discriminatorUnknownValue(
+	tn string, start int, do discriminatorOpts, err error) (reflect.Value, error) {
+
+	fn := d.discriminatorUnknownTypeFn
+	if de, ok := err.(*DiscriminatorError); !ok || de.Reason != reasonUnknownType || fn == nil {
+		return reflect.Value{}, err
+	}
+
+	// Advance past the end of the JSON object or array.
+	if d.opcode == scanSkipSpace {
+		d.scanWhile(scanSkipSpace)
+	}
+	if d.opcode != scanEndObject && d.opcode != scanEndArray {
+		d.skip()
+	}
+
+	// The data is copied since a Decoder reuses its buffer.
+	raw := append(RawMessage(nil), d.data[start:d.off]...)
+	uv, ferr := fn(tn, raw)
+	if ferr != nil {
+		return reflect.Value{}, ferr
+	}
+	if uv == nil || !reflect.TypeOf(uv).AssignableTo(do.iface) {
+		return reflect.Value{}, err
+	}
+	v := reflect.New(reflect.TypeOf(uv))
+	v.Elem().Set(reflect.ValueOf(uv))
+	return v, nil
+}
+
+// discriminatorUnknownEncode writes the original JSON value of the
+// placeholder v.
+func discriminatorUnknownEncode(e *encodeState, v reflect.Value) {
+	u := v.Interface().(UnknownDiscriminated)
+	raw, _ := u.MarshalJSON()
+	if !Valid(raw) {
+		e.error(&UnsupportedValueError{v, fmt.Sprintf(
+			"invalid JSON for unknown type %s", u.TypeName)})
+	}
+	e.Write(raw)
+}
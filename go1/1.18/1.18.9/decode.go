@@ -88,6 +88,10 @@ import (
 // ``not present,'' unmarshaling a JSON null into any other Go type has no effect
 // on the value and produces no error.
 //
+// The line and column at which an error occurred are reported by the Line
+// and Column fields of a SyntaxError, UnmarshalTypeError, or
+// DiscriminatorError, together with an excerpt of the JSON input.
+//
 // When unmarshaling quoted strings, invalid UTF-8 or
 // invalid UTF-16 surrogate pairs are not treated as an error.
 // Instead, they are replaced by the Unicode replacement
@@ -100,11 +104,11 @@ func Unmarshal(data []byte, v any) error {
 	var d decodeState
 	err := checkValid(data, &d.scan)
 	if err != nil {
-		return err
+		return setErrorPosition(err, data, 0, 1, 1)
 	}
 
 	d.init(data)
-	return d.unmarshal(v)
+	return setErrorPosition(d.unmarshal(v), data, 0, 1, 1)
 }
 
 // Unmarshaler is the interface implemented by types
@@ -122,11 +126,14 @@ type Unmarshaler interface {
 // An UnmarshalTypeError describes a JSON value that was
 // not appropriate for a value of a specific Go type.
 type UnmarshalTypeError struct {
-	Value  string       // description of JSON value - "bool", "array", "number -5"
-	Type   reflect.Type // type of Go value it could not be assigned to
-	Offset int64        // error occurred after reading Offset bytes
-	Struct string       // name of the struct type containing the field
-	Field  string       // the full path from root node to the field
+	Value   string       // description of JSON value - "bool", "array", "number -5"
+	Type    reflect.Type // type of Go value it could not be assigned to
+	Offset  int64        // error occurred after reading Offset bytes
+	Struct  string       // name of the struct type containing the field
+	Field   string       // the full path from root node to the field
+	Line    int          // line on which the error occurred, starting at 1
+	Column  int          // column at which the error occurred, in bytes, starting at 1
+	Excerpt string       // line on which the error occurred, with a caret below Column
 }
 
 func (e *UnmarshalTypeError) Error() string {
@@ -220,6 +227,39 @@ type decodeState struct {
 	discriminatorTypeFieldName   string
 	discriminatorValueFieldName  string
 	discriminatorToTypeFn        DiscriminatorToTypeFunc
+	discriminatorTypeRegistry    *TypeRegistry
+	discriminatorLayout          DiscriminatorLayout
+	discriminatorUnknownTypeFn   UnknownTypeFunc
+
+	// disallowTypeNameMismatch causes an error to be saved when the type
+	// name of a JSON object decoded into a map or struct does not match
+	// the map or struct type.
+	disallowTypeNameMismatch bool
+
+	// discriminatorObjectTypeFieldName is the name of the type field that
+	// is skipped when decoding the next object. It is reset as soon as the
+	// object is decoded.
+	discriminatorObjectTypeFieldName string
+
+	// discriminatorObjectValueFieldName is the value field name of the
+	// interface in which the next object is stored, if the object is decoded
+	// into a map. It is reset as soon as the object is decoded.
+	discriminatorObjectValueFieldName string
+
+	// discriminatorObjectResumed indicates the next object is decoded after
+	// its first field, the type field, was read already. It is reset as soon
+	// as the object is decoded.
+	discriminatorObjectResumed bool
+
+	// discriminatorField holds the discriminator options of the struct
+	// field being decoded.
+	discriminatorField fieldDiscriminator
+
+	// decodePolicy limits the resources used to decode the data, and
+	// discriminatedValues is the number of discriminated values decoded
+	// into interfaces so far.
+	decodePolicy        DecodePolicy
+	discriminatedValues int
 }
 
 // readIndex returns the position of the last byte read.
@@ -236,6 +276,7 @@ func (d *decodeState) init(data []byte) *decodeState {
 	d.data = data
 	d.off = 0
 	d.savedError = nil
+	d.discriminatedValues = 0
 	if d.errorContext != nil {
 		d.errorContext.Struct = nil
 		// Reuse the allocated space for the FieldStack slice.
@@ -423,7 +464,8 @@ func (d *decodeState) valueQuoted() any {
 
 // indirect walks down v allocating pointers as needed,
 // until it gets to a non-pointer.
-// If it encounters an Unmarshaler, indirect stops and returns that.
+// If it encounters an Unmarshaler, indirect stops and returns that. An
+// UnmarshalerWithOptions is returned as an optionsUnmarshaler.
 // If decodingNull is true, indirect stops at the first settable pointer so it
 // can be set to nil.
 func indirect(v reflect.Value, decodingNull bool) (Unmarshaler, encoding.TextUnmarshaler, reflect.Value) {
@@ -479,6 +521,9 @@ func indirect(v reflect.Value, decodingNull bool) (Unmarshaler, encoding.TextUnm
 			v.Set(reflect.New(v.Type().Elem()))
 		}
 		if v.Type().NumMethod() > 0 && v.CanInterface() {
+			if u, ok := v.Interface().(UnmarshalerWithOptions); ok {
+				return optionsUnmarshaler{u}, nil, reflect.Value{}
+			}
 			if u, ok := v.Interface().(Unmarshaler); ok {
 				return u, nil, reflect.Value{}
 			}
@@ -507,7 +552,7 @@ func (d *decodeState) array(v reflect.Value) error {
 	if u != nil {
 		start := d.readIndex()
 		d.skip()
-		return u.UnmarshalJSON(d.data[start:d.off])
+		return d.unmarshalJSON(u, d.data[start:d.off], start)
 	}
 	if ut != nil {
 		d.saveError(&UnmarshalTypeError{Value: "array", Type: v.Type(), Offset: int64(d.off)})
@@ -519,6 +564,19 @@ func (d *decodeState) array(v reflect.Value) error {
 	// Check type of target.
 	switch v.Kind() {
 	case reflect.Interface:
+		do, isDiscriminated := d.discriminatorFor(v.Type())
+		if isDiscriminated && do.layout == DiscriminatorLayoutTuple {
+			return d.discriminatorInterfaceDecode(v.Type(), v, do)
+		}
+		if v.NumMethod() == 0 && isDiscriminated {
+			// The elements may be discriminated values as well.
+			av := reflect.New(sliceInterfaceType).Elem()
+			if err := d.array(av); err != nil {
+				return err
+			}
+			v.Set(av)
+			return nil
+		}
 		if v.NumMethod() == 0 {
 			// Decoding into nil interface? Switch to non-reflect code.
 			ai := d.arrayInterface()
@@ -613,9 +671,19 @@ func (d *decodeState) object(v reflect.Value) error {
 	if u != nil {
 		start := d.readIndex()
 		d.skip()
-		return u.UnmarshalJSON(d.data[start:d.off])
+		data := d.data[start:d.off]
+		d.discriminatorObjectValueFieldName = ""
+		// The type field added to the object when it was stored in an
+		// interface is not given to the unmarshaler.
+		if tf := d.discriminatorObjectTypeFieldName; tf != "" {
+			d.discriminatorObjectTypeFieldName = ""
+			data = discriminatorStripTypeField(data, tf)
+		}
+		return d.unmarshalJSON(u, data, start)
 	}
 	if ut != nil {
+		d.discriminatorObjectTypeFieldName = ""
+		d.discriminatorObjectValueFieldName = ""
 		d.saveError(&UnmarshalTypeError{Value: "object", Type: v.Type(), Offset: int64(d.off)})
 		d.skip()
 		return nil
@@ -623,8 +691,44 @@ func (d *decodeState) object(v reflect.Value) error {
 	v = pv
 	t := v.Type()
 
+	objStart := d.readIndex()
+	resumed := d.discriminatorObjectResumed
+	d.discriminatorObjectResumed = false
+
+	// The type field is skipped when decoding a map or struct. Its type
+	// name is checked unless it was read already to decode an interface.
+	var typeFieldName string
+	checkTypeName := d.disallowTypeNameMismatch && !resumed
+	if d.isDiscriminatorSet() && d.discriminatorLayout == DiscriminatorLayoutInline {
+		typeFieldName = d.discriminatorTypeFieldName
+	}
+	// typed indicates the object is known to have the type field.
+	typed := resumed
+	// valueFieldName is the value field of the interface in which a map is
+	// stored. A map with only a null value field is decoded as a nil map.
+	valueFieldName := d.discriminatorObjectValueFieldName
+	d.discriminatorObjectValueFieldName = ""
+	var nilMap bool
+	if d.discriminatorObjectTypeFieldName != "" {
+		typeFieldName = d.discriminatorObjectTypeFieldName
+		d.discriminatorObjectTypeFieldName = ""
+		checkTypeName = false
+		typed = true
+	} else if fd := d.discriminatorField; fd.typed && fd.typeFieldName != "" {
+		typeFieldName = fd.typeFieldName
+		typed = true
+	}
+	do, isDiscriminated := d.discriminatorFor(t)
+
+	// The field options apply only to this object and not to the values
+	// nested in it.
+	defer func(fd fieldDiscriminator) {
+		d.discriminatorField = fd
+	}(d.discriminatorField)
+	d.discriminatorField = fieldDiscriminator{}
+
 	// Decoding into nil interface? Switch to non-reflect code.
-	if v.Kind() == reflect.Interface && v.NumMethod() == 0 && !d.isDiscriminatorSet() {
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 && !isDiscriminated {
 		oi := d.objectInterface()
 		v.Set(reflect.ValueOf(oi))
 		return nil
@@ -656,10 +760,14 @@ func (d *decodeState) object(v reflect.Value) error {
 		}
 	case reflect.Struct:
 		fields = cachedTypeFields(t)
-		// ok
+		if typed {
+			if err := cachedTypeFieldCollision(t, typeFieldName); err != nil {
+				d.saveError(err)
+			}
+		}
 	default:
-		if d.isDiscriminatorSet() {
-			return d.discriminatorInterfaceDecode(t, v)
+		if isDiscriminated {
+			return d.discriminatorInterfaceDecode(t, v, do)
 		}
 		d.saveError(&UnmarshalTypeError{Value: "object", Type: t, Offset: int64(d.off)})
 		d.skip()
@@ -673,6 +781,12 @@ func (d *decodeState) object(v reflect.Value) error {
 	}
 
 	for {
+		// If the object is resumed after its type field then the closing }
+		// may have been read already.
+		if resumed && d.opcode == scanEndObject {
+			break
+		}
+
 		// Read opening " of string key or closing }.
 		d.scanWhile(scanSkipSpace)
 		if d.opcode == scanEndObject {
@@ -695,8 +809,26 @@ func (d *decodeState) object(v reflect.Value) error {
 		// Figure out field corresponding to key.
 		var subv reflect.Value
 		destring := false // whether the value is wrapped in a string to be decoded first
-
-		if v.Kind() == reflect.Map {
+		var fd fieldDiscriminator
+
+		// The discriminator's type field is not stored in a map, or in a
+		// struct without a field of the same name.
+		isTypeField := v.Kind() == reflect.Map &&
+			typeFieldName != "" && string(key) == typeFieldName
+		isValueField := v.Kind() == reflect.Map &&
+			valueFieldName != "" && string(key) == valueFieldName
+
+		if isTypeField {
+			// subv is invalid so d.value(subv) skips over the JSON value.
+		} else if v.Kind() == reflect.Map {
+			if typeFieldName != "" && isDiscriminatorKey(string(key), typeFieldName) ||
+				valueFieldName != "" && !isValueField &&
+					isDiscriminatorKey(string(key), valueFieldName) {
+				// Remove the prefix that escapes a key that collides
+				// with the type or value field.
+				key = key[len(discriminatorKeyPrefix):]
+				item = discriminatorUnescapeKey(item)
+			}
 			elemType := t.Elem()
 			if !mapElem.IsValid() {
 				mapElem = reflect.New(elemType).Elem()
@@ -723,6 +855,7 @@ func (d *decodeState) object(v reflect.Value) error {
 			if f != nil {
 				subv = v
 				destring = f.quoted
+				fd = f.discriminator
 				for _, i := range f.index {
 					if subv.Kind() == reflect.Pointer {
 						if subv.IsNil() {
@@ -750,6 +883,8 @@ func (d *decodeState) object(v reflect.Value) error {
 				}
 				d.errorContext.FieldStack = append(d.errorContext.FieldStack, f.name)
 				d.errorContext.Struct = t
+			} else if typeFieldName != "" && string(key) == typeFieldName {
+				isTypeField = true
 			} else if d.disallowUnknownFields {
 				d.saveError(fmt.Errorf("json: unknown field %q", key))
 			}
@@ -764,7 +899,17 @@ func (d *decodeState) object(v reflect.Value) error {
 		}
 		d.scanWhile(scanSkipSpace)
 
-		if destring {
+		// A null value field is not stored in the map.
+		isNilValueField := isValueField &&
+			d.opcode == scanBeginLiteral && d.data[d.readIndex()] == 'n'
+		if isNilValueField {
+			nilMap = true
+			subv = reflect.Value{}
+		}
+
+		if isTypeField && checkTypeName {
+			d.discriminatorCheckTypeName(t, objStart)
+		} else if destring {
 			switch qv := d.valueQuoted().(type) {
 			case nil:
 				if err := d.literalStore(nullLiteral, subv, false); err != nil {
@@ -777,7 +922,12 @@ func (d *decodeState) object(v reflect.Value) error {
 			default:
 				d.saveError(fmt.Errorf("json: invalid use of ,string struct tag, trying to unmarshal unquoted value into %v", subv.Type()))
 			}
+		} else if fd.untyped {
+			if err := d.valueWithoutDiscriminator(subv); err != nil {
+				return err
+			}
 		} else {
+			d.discriminatorField = fd
 			if err := d.value(subv); err != nil {
 				return err
 			}
@@ -785,7 +935,7 @@ func (d *decodeState) object(v reflect.Value) error {
 
 		// Write value back to map;
 		// if using struct, subv points into struct already.
-		if v.Kind() == reflect.Map {
+		if v.Kind() == reflect.Map && !isTypeField && !isNilValueField {
 			kt := t.Key()
 			var kv reflect.Value
 			switch {
@@ -820,9 +970,7 @@ func (d *decodeState) object(v reflect.Value) error {
 				}
 			}
 			if kv.IsValid() {
-				if !d.isDiscriminatorSet() || kv.String() != d.discriminatorTypeFieldName {
-					v.SetMapIndex(kv, subv)
-				}
+				v.SetMapIndex(kv, subv)
 			}
 		}
 
@@ -844,6 +992,9 @@ func (d *decodeState) object(v reflect.Value) error {
 			panic(phasePanicMsg)
 		}
 	}
+	if nilMap && v.Len() == 0 {
+		v.Set(reflect.Zero(t))
+	}
 	return nil
 }
 
@@ -877,7 +1028,11 @@ func (d *decodeState) literalStore(item []byte, v reflect.Value, fromQuoted bool
 	isNull := item[0] == 'n' // null
 	u, ut, pv := indirect(v, isNull)
 	if u != nil {
-		return u.UnmarshalJSON(item)
+		start := d.readIndex() - len(item)
+		if start < 0 {
+			start = 0
+		}
+		return d.unmarshalJSON(u, item, start)
 	}
 	if ut != nil {
 		if item[0] != '"' {
@@ -7,18 +7,180 @@ package json
 import (
 	"fmt"
 	"reflect"
-	"regexp"
 	"strconv"
+	"strings"
 	"sync"
+	"unicode/utf8"
 )
 
 // DiscriminatorToTypeFunc is used to get a reflect.Type from its
 // discriminator.
 type DiscriminatorToTypeFunc func(discriminator string) (reflect.Type, bool)
 
+// TypeToDiscriminatorFunc is used to get the discriminator for a
+// reflect.Type.
+type TypeToDiscriminatorFunc func(t reflect.Type) (string, bool)
+
+// TypeNamer is the interface implemented by types that provide the type
+// names with which they are encoded by the discriminator.
+//
+// A struct type may also provide its type name with the "jsontype" tag on a
+// blank field, ex.:
+//
+//	type Dog struct {
+//		_ struct{} `jsontype:"dog"`
+//	}
+//
+// Please note a TypeRegistry is still required to decode these type names,
+// ex. by calling TypeRegistry.Register with an empty name.
+type TypeNamer interface {
+	JSONTypeName() string
+}
+
+// An InterfaceDiscriminator describes the discriminator used to encode and
+// decode the values stored in a specific interface type. Please see
+// TypeRegistry.RegisterInterface for more information.
+type InterfaceDiscriminator struct {
+	// TypeFieldName, if not empty, is used instead of the encoder's or
+	// decoder's type field name for values stored in the interface.
+	TypeFieldName string
+
+	// ValueFieldName, if not empty, is used instead of the encoder's or
+	// decoder's value field name for values stored in the interface.
+	ValueFieldName string
+
+	// Types is an optional registry used to look up the type names of the
+	// values stored in the interface before the encoder's or decoder's
+	// TypeRegistry.
+	Types *TypeRegistry
+
+	// AllowedTypes, if not empty, is the closed set of types that may be
+	// stored in the interface. An error is returned when encoding or
+	// decoding a value of any other type, even if the type is known to the
+	// encoder or decoder.
+	AllowedTypes []reflect.Type
+
+	// Layout, if not DiscriminatorLayoutInline, is used instead of the
+	// encoder's or decoder's layout for values stored in the interface.
+	Layout DiscriminatorLayout
+
+	// DefaultType, if not nil, is the type into which a JSON object without
+	// a type field is decoded. Otherwise such an object is decoded into a
+	// map[string]interface{} if the interface is empty, and an error is
+	// returned if it is not.
+	DefaultType reflect.Type
+}
+
+// isAllowed reports whether the type t, or a pointer to t, may be stored in
+// the interface.
+func (d *InterfaceDiscriminator) isAllowed(t reflect.Type) bool {
+	if d == nil || len(d.AllowedTypes) == 0 {
+		return true
+	}
+	for _, at := range d.AllowedTypes {
+		if at == t || (t.Kind() != reflect.Ptr && at == cachedPointerType(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultType returns the type into which a JSON object without a type field
+// is decoded for the interface type t. A nil type is returned if there is
+// no such type.
+func (d *InterfaceDiscriminator) defaultType(t reflect.Type) reflect.Type {
+	if d != nil && d.DefaultType != nil {
+		return d.DefaultType
+	}
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		return mapStringInterfaceType
+	}
+	return nil
+}
+
+var (
+	mapStringInterfaceType = reflect.TypeOf(map[string]interface{}(nil))
+	sliceInterfaceType     = reflect.TypeOf([]interface{}(nil))
+)
+
+// discriminatorOpts describes the discriminator used to encode or decode a
+// single value.
+type discriminatorOpts struct {
+	typeFieldName  string
+	valueFieldName string
+	layout         DiscriminatorLayout
+
+	// iface is the interface type into which the value is decoded or from
+	// which the value is encoded, and id is the discriminator registered for
+	// it, if any.
+	iface reflect.Type
+	id    *InterfaceDiscriminator
+}
+
+// fieldDiscriminator describes the discriminator options in a struct field's
+// "json" tag:
+//
+//   - discriminator=name specifies the type field name used for the field's
+//     value instead of the encoder's or decoder's type field name.
+//   - typed causes the type name to be encoded for the field's map or struct
+//     value even though the value is not stored in an interface.
+//   - untyped causes the field's value, and any values nested in it, to be
+//     encoded and decoded without a discriminator.
+//
+// The options apply to the elements of a slice or array value as well.
+type fieldDiscriminator struct {
+	typeFieldName string
+	typed         bool
+	untyped       bool
+}
+
+func parseFieldDiscriminator(opts tagOptions) fieldDiscriminator {
+	typeFieldName, _ := opts.Value("discriminator")
+	return fieldDiscriminator{
+		typeFieldName: typeFieldName,
+		typed:         opts.Contains("typed"),
+		untyped:       opts.Contains("untyped"),
+	}
+}
+
+// newDiscriminatorOpts returns the discriminator used for values stored in
+// the type t. A false value is returned if there is no discriminator.
+func newDiscriminatorOpts(
+	t reflect.Type,
+	typeFieldName, valueFieldName string,
+	layout DiscriminatorLayout,
+	registry *TypeRegistry,
+	fd fieldDiscriminator) (discriminatorOpts, bool) {
+
+	do := discriminatorOpts{
+		typeFieldName:  typeFieldName,
+		valueFieldName: valueFieldName,
+		layout:         layout,
+		iface:          t,
+	}
+	if registry != nil && t.Kind() == reflect.Interface {
+		if id, ok := registry.interfaceOf(t); ok {
+			do.id = id
+			if id.TypeFieldName != "" {
+				do.typeFieldName = id.TypeFieldName
+			}
+			if id.ValueFieldName != "" {
+				do.valueFieldName = id.ValueFieldName
+			}
+			if id.Layout != DiscriminatorLayoutInline {
+				do.layout = id.Layout
+			}
+		}
+	}
+	if fd.typeFieldName != "" {
+		do.typeFieldName = fd.typeFieldName
+	}
+	return do, do.layout.isSet(do.typeFieldName, do.valueFieldName)
+}
+
 // DiscriminatorEncodeMode is a mask that describes the different encode
 // options.
-type DiscriminatorEncodeMode uint8
+type DiscriminatorEncodeMode uint16
 
 const (
 	// DiscriminatorEncodeTypeNameIfRequired is the default behavior when
@@ -37,6 +199,45 @@ const (
 	// DiscriminatorEncodeTypeNameWithPath causes the type name to be encoded
 	// prefixed with the type's full package path.
 	DiscriminatorEncodeTypeNameWithPath
+
+	// DiscriminatorEncodeTypeNameRegisteredOnly causes an error to be
+	// returned when encoding the type name of a named type that is not
+	// registered with the encoder's TypeRegistry. Built-in types are always
+	// registered.
+	DiscriminatorEncodeTypeNameRegisteredOnly
+
+	// DiscriminatorEncodeTypeNameTypeArgsWithPath causes the type arguments
+	// of instantiated generic types to be encoded prefixed with their full
+	// package paths, ex. "Box[example.com/pkg.Foo]" instead of "Box[Foo]".
+	// Type arguments are always prefixed with their full package paths when
+	// DiscriminatorEncodeTypeNameWithPath is set.
+	DiscriminatorEncodeTypeNameTypeArgsWithPath
+
+	// DiscriminatorEncodeTypeNamePointers causes a pointer stored in an
+	// interface to be encoded with the name of the pointer type, ex. "*Dog",
+	// instead of the name of the type to which it points, so the pointer
+	// is decoded as a pointer rather than a value. The value to which the
+	// pointer points is encoded inside an outer JSON object, ex.
+	// {"type":"*Dog","value":{"name":"Rex"}}, even if it is a map or struct.
+	DiscriminatorEncodeTypeNamePointers
+
+	// DiscriminatorEncodeTypeNameOmitUnparseable causes a value whose type
+	// name cannot be parsed when it is decoded, ex. an anonymous struct with
+	// an unexported field, to be encoded without a type name instead of
+	// returning an error. A value stored in an interface is then encoded as
+	// if it were not, so it is decoded as a map, slice, or other value of
+	// the interface's default type, ex. map[string]interface{} for an
+	// empty interface.
+	DiscriminatorEncodeTypeNameOmitUnparseable
+
+	// DiscriminatorEncodeTypeNameQualifiedElems causes the named key,
+	// element, and field types of unnamed pointer, slice, array, map, and
+	// struct types to be encoded as they are by the String method of the
+	// unnamed type, ex. "[]pkg.Dog" instead of "[]Dog", unless they are
+	// registered or define their own type names. This is compatible with
+	// the type names encoded before the names of unnamed types were derived
+	// from the names of their key, element, and field types.
+	DiscriminatorEncodeTypeNameQualifiedElems
 )
 
 func (m DiscriminatorEncodeMode) root() bool {
@@ -51,214 +252,583 @@ func (m DiscriminatorEncodeMode) withPath() bool {
 	return m&DiscriminatorEncodeTypeNameWithPath > 0
 }
 
+func (m DiscriminatorEncodeMode) registeredOnly() bool {
+	return m&DiscriminatorEncodeTypeNameRegisteredOnly > 0
+}
+
+func (m DiscriminatorEncodeMode) typeArgsWithPath() bool {
+	return m&(DiscriminatorEncodeTypeNameTypeArgsWithPath|DiscriminatorEncodeTypeNameWithPath) > 0
+}
+
+func (m DiscriminatorEncodeMode) pointers() bool {
+	return m&DiscriminatorEncodeTypeNamePointers > 0
+}
+
+func (m DiscriminatorEncodeMode) omitUnparseable() bool {
+	return m&DiscriminatorEncodeTypeNameOmitUnparseable > 0
+}
+
+func (m DiscriminatorEncodeMode) qualifiedElems() bool {
+	return m&DiscriminatorEncodeTypeNameQualifiedElems > 0
+}
+
+// MarshalWithDiscriminator is like Marshal but encodes the type information
+// for values stored in interfaces. Please see Encoder.SetDiscriminator for
+// more information about the typeFieldName, valueFieldName, and mode
+// parameters.
+func MarshalWithDiscriminator(
+	v interface{},
+	typeFieldName, valueFieldName string,
+	mode DiscriminatorEncodeMode) ([]byte, error) {
+
+	e := newEncodeState()
+	defer encodeStatePool.Put(e)
+
+	err := e.marshal(v, encOpts{
+		escapeHTML:                  true,
+		discriminatorTypeFieldName:  typeFieldName,
+		discriminatorValueFieldName: valueFieldName,
+		discriminatorEncodeMode:     mode,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), e.Bytes()...), nil
+}
+
+// UnmarshalWithDiscriminator is like Unmarshal but uses the type information
+// encoded in JSON objects to decode values into interfaces. Please see
+// Decoder.SetDiscriminator for more information about the typeFieldName,
+// valueFieldName, and typeFn parameters.
+func UnmarshalWithDiscriminator(
+	data []byte,
+	v interface{},
+	typeFieldName, valueFieldName string,
+	typeFn DiscriminatorToTypeFunc) error {
+
+	// Check for well-formedness.
+	// Avoids filling out half a data structure
+	// before discovering a JSON syntax error.
+	var d decodeState
+	err := checkValid(data, &d.scan)
+	if err != nil {
+		return setErrorPosition(err, data, 0, 1, 1)
+	}
+
+	d.init(data)
+	d.discriminatorTypeFieldName = typeFieldName
+	d.discriminatorValueFieldName = valueFieldName
+	d.discriminatorToTypeFn = typeFn
+	return setErrorPosition(d.unmarshal(v), data, 0, 1, 1)
+}
+
 func (d *decodeState) isDiscriminatorSet() bool {
-	return d.discriminatorTypeFieldName != "" &&
-		d.discriminatorValueFieldName != ""
+	return d.discriminatorLayout.isSet(
+		d.discriminatorTypeFieldName,
+		d.discriminatorValueFieldName)
 }
 
-// discriminatorOpType describes the current operation related to
-// discriminators when reading a JSON object's fields.
-type discriminatorOpType uint8
+// discriminatorFor returns the discriminator used to decode a JSON object
+// into a value of type t.
+func (d *decodeState) discriminatorFor(t reflect.Type) (discriminatorOpts, bool) {
+	return newDiscriminatorOpts(
+		t,
+		d.discriminatorTypeFieldName,
+		d.discriminatorValueFieldName,
+		d.discriminatorLayout,
+		d.discriminatorTypeRegistry,
+		d.discriminatorField)
+}
 
-const (
-	// discriminatorOpTypeNameField indicates the discriminator type name
-	// field was discovered.
-	discriminatorOpTypeNameField = iota + 1
+// valueWithoutDiscriminator is like value but decodes v, and any values
+// nested in v, without a discriminator.
+func (d *decodeState) valueWithoutDiscriminator(v reflect.Value) error {
+	defer d.withoutDiscriminator()()
+	return d.value(v)
+}
 
-	// discriminatorOpValueField indicates the discriminator value field
-	// was discovered.
-	discriminatorOpValueField
-)
+// withoutDiscriminator disables the discriminator, returning a function
+// that restores it.
+func (d *decodeState) withoutDiscriminator() func() {
+	typeFieldName := d.discriminatorTypeFieldName
+	valueFieldName := d.discriminatorValueFieldName
+	layout := d.discriminatorLayout
+	registry := d.discriminatorTypeRegistry
+	d.discriminatorTypeFieldName = ""
+	d.discriminatorValueFieldName = ""
+	d.discriminatorLayout = DiscriminatorLayoutInline
+	d.discriminatorTypeRegistry = nil
+	return func() {
+		d.discriminatorTypeFieldName = typeFieldName
+		d.discriminatorValueFieldName = valueFieldName
+		d.discriminatorLayout = layout
+		d.discriminatorTypeRegistry = registry
+	}
+}
 
-func (d *decodeState) discriminatorGetValue() (reflect.Value, error) {
+// discriminatorGetValue decodes the discriminated JSON object, the first
+// byte ('{') of which has been read already, into a new value of the type
+// named by the object's type field.
+//
+// The object's keys are scanned in place, skipping their values, until the
+// type field is found. If the type field is the first field then the object
+// is decoded without being scanned again. Otherwise the object is scanned a
+// second time to decode it once its type is known.
+func (d *decodeState) discriminatorGetValue(do discriminatorOpts) (reflect.Value, error) {
 	// Record the current offset so we know where the data starts.
 	offset := d.readIndex()
 
-	// Create a temporary decodeState used to inspect the current object
-	// and determine its discriminator type and decode its value.
-	dd := &decodeState{
-		disallowUnknownFields:       d.disallowUnknownFields,
-		useNumber:                   d.useNumber,
-		discriminatorToTypeFn:       d.discriminatorToTypeFn,
-		discriminatorTypeFieldName:  d.discriminatorTypeFieldName,
-		discriminatorValueFieldName: d.discriminatorValueFieldName,
-	}
-	dd.init(append([]byte{}, d.data[offset:]...))
-	defer freeScanner(&dd.scan)
-	dd.scan.reset()
-
 	var (
-		t        reflect.Type // the instance of the type
-		valueOff = -1         // the offset of a possible discriminator value
+		tn       string        // the type name
+		t        reflect.Type  // the instance of the type
+		v        reflect.Value // the value into which the data is decoded
+		decoded  bool          // whether the data has been decoded into v
+		valueOff = -1          // the offset of a possible discriminator value
 	)
 
-	dd.scanWhile(scanSkipSpace)
-	if dd.opcode != scanBeginObject {
-		panic(phasePanicMsg)
-	}
-
-	for {
-		dd.scanWhile(scanSkipSpace)
-		if dd.opcode == scanEndObject {
+	for first := true; ; first = false {
+		// Read opening " of string key or closing }.
+		d.scanWhile(scanSkipSpace)
+		if d.opcode == scanEndObject {
 			// closing } - can only happen on first iteration.
 			break
 		}
-		if dd.opcode != scanBeginLiteral {
+		if d.opcode != scanBeginLiteral {
 			panic(phasePanicMsg)
 		}
 
 		// Read key.
-		start := dd.readIndex()
-		dd.rescanLiteral()
-		item := dd.data[start:dd.readIndex()]
-		key, ok := unquote(item)
+		start := d.readIndex()
+		d.rescanLiteral()
+		key, ok := unquoteBytes(d.data[start:d.readIndex()])
 		if !ok {
 			panic(phasePanicMsg)
 		}
 
-		// Check to see if the key is related to the discriminator.
-		var discriminatorOp discriminatorOpType
-		switch key {
-		case d.discriminatorTypeFieldName:
-			discriminatorOp = discriminatorOpTypeNameField
-		case d.discriminatorValueFieldName:
-			discriminatorOp = discriminatorOpValueField
-		}
-
 		// Read : before value.
-		if dd.opcode == scanSkipSpace {
-			dd.scanWhile(scanSkipSpace)
+		if d.opcode == scanSkipSpace {
+			d.scanWhile(scanSkipSpace)
 		}
-
-		if dd.opcode != scanObjectKey {
+		if d.opcode != scanObjectKey {
 			panic(phasePanicMsg)
 		}
-		dd.scanWhile(scanSkipSpace)
-
-		// Read value.
-		valOff := dd.readIndex()
-		val := dd.valueInterface()
+		d.scanWhile(scanSkipSpace)
+		valOff := d.readIndex()
 
-		switch discriminatorOp {
-		case discriminatorOpTypeNameField:
-			tn, ok := val.(string)
-			if !ok {
-				return reflect.Value{}, fmt.Errorf(
+		switch {
+		case t == nil && string(key) == do.typeFieldName:
+			if d.opcode != scanBeginLiteral || d.data[valOff] != '"' {
+				return reflect.Value{}, newDiscriminatorError(
+					reasonTypeNotString, "", valOff,
 					"json: discriminator type at offset %d is not string",
-					offset+valOff)
+					valOff)
+			}
+			d.rescanLiteral()
+			if tn, ok = unquote(d.data[valOff:d.readIndex()]); !ok {
+				panic(phasePanicMsg)
 			}
 			if tn == "" {
-				return reflect.Value{}, fmt.Errorf(
+				return reflect.Value{}, newDiscriminatorError(
+					reasonEmptyType, "", valOff,
 					"json: discriminator type at offset %d is empty",
-					offset+valOff)
+					valOff)
 			}
 
 			// Parse the type name into a type instance.
-			ti, err := discriminatorParseTypeName(tn, d.discriminatorToTypeFn)
+			ti, err := d.discriminatorParseType(tn, do)
 			if err != nil {
-				return reflect.Value{}, err
+				return d.discriminatorUnknownValue(tn, offset, do, err)
 			}
 
 			// Assign the type instance to the outer variable, t.
 			t = ti
 
-			switch t.Kind() {
-			case reflect.Map, reflect.Struct:
-				// If the type is a map or a struct then it is not necessary to
-				// continue walking over the current JSON object since it will be
-				// completely rescanned to decode its value into the discovered
-				// type.
-				dd.opcode = scanEndObject
-			default:
-				// Otherwise if the value offset has been discovered then it is
-				// safe to stop walking over the current JSON object as well.
-				if valueOff > -1 {
-					dd.opcode = scanEndObject
+			// Instantiate a new instance of the discriminated type.
+			if v, err = discriminatorNewValue(t); err != nil {
+				return reflect.Value{}, err
+			}
+
+			// If the type field is the first field of an inlined map or
+			// struct then the remaining fields are decoded into v in place.
+			if first && do.isInline(t) {
+				if u, ut, _ := indirect(v, false); u == nil && ut == nil {
+					if d.opcode == scanSkipSpace {
+						d.scanWhile(scanSkipSpace)
+					}
+					d.discriminatorObjectResumed = true
+					d.discriminatorObjectTypeFieldName = do.typeFieldName
+					d.discriminatorObjectValueFieldName = do.valueFieldName
+					err := d.object(v)
+					d.discriminatorObjectTypeFieldName = ""
+					d.discriminatorObjectValueFieldName = ""
+					if err != nil {
+						return reflect.Value{}, err
+					}
+					return v, nil
+				}
+			}
+		case string(key) == do.valueFieldName && !decoded:
+			if t != nil && !do.isInline(t) {
+				// The type has been discovered so the value is decoded
+				// into v in place.
+				if err := d.value(v); err != nil {
+					return reflect.Value{}, err
 				}
+				decoded = true
+				break
 			}
-		case discriminatorOpValueField:
 			valueOff = valOff
+			d.value(reflect.Value{})
+		default:
+			// Skip over the value.
+			d.value(reflect.Value{})
+		}
+
+		// Next token must be , or }.
+		if d.opcode == scanSkipSpace {
+			d.scanWhile(scanSkipSpace)
+		}
+		if d.opcode == scanEndObject {
+			break
+		}
+		if d.opcode != scanObjectValue {
+			panic(phasePanicMsg)
+		}
+	}
+
+	// If there is not a type discriminator then the object is decoded into
+	// the interface's default type, if any.
+	untyped := t == nil
+	if untyped {
+		if t = do.id.defaultType(do.iface); t == nil {
+			return reflect.Value{}, newDiscriminatorError(
+				reasonMissingType, "", offset, "json: missing discriminator")
+		}
+		var err error
+		if v, err = discriminatorNewValue(t); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	if decoded {
+		return v, nil
+	}
+
+	// Create a temporary decodeState used to decode the value now that its
+	// type is known. The data is shared with the current decodeState, so
+	// the object is never copied.
+	dd := &decodeState{
+		disallowUnknownFields:       d.disallowUnknownFields,
+		useNumber:                   d.useNumber,
+		discriminatorToTypeFn:       d.discriminatorToTypeFn,
+		discriminatorTypeFieldName:  d.discriminatorTypeFieldName,
+		discriminatorValueFieldName: d.discriminatorValueFieldName,
+		discriminatorLayout:         d.discriminatorLayout,
+		discriminatorTypeRegistry:   d.discriminatorTypeRegistry,
+		discriminatorUnknownTypeFn:  d.discriminatorUnknownTypeFn,
+		disallowTypeNameMismatch:    d.disallowTypeNameMismatch,
+		decodePolicy:                d.decodePolicy,
+	}
+	dd.init(d.data)
+	dd.discriminatedValues = d.discriminatedValues
+	dd.scan.reset()
+	if d.errorContext != nil {
+		dd.errorContext = &errorContext{
+			Struct:     d.errorContext.Struct,
+			FieldStack: append([]string(nil), d.errorContext.FieldStack...),
+		}
+	}
+
+	switch {
+	case untyped || do.isInline(t):
+		// Decode the entire object into v, skipping the type field.
+		dd.off = offset
+		dd.discriminatorObjectTypeFieldName = do.typeFieldName
+		if !untyped {
+			dd.discriminatorObjectValueFieldName = do.valueFieldName
+		}
+	case valueOff < 0:
+		return reflect.Value{}, newDiscriminatorError(
+			reasonMissingValue, tn, offset,
+			"json: missing discriminator value at offset %d", offset)
+	default:
+		// Decode only the discriminator value into v.
+		dd.off = valueOff
+	}
+
+	// This will initialize the correct scan step and op code.
+	dd.scanWhile(scanSkipSpace)
+
+	// Decode the data into the value.
+	err := dd.value(v)
+	d.discriminatedValues = dd.discriminatedValues
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if d.savedError == nil {
+		// The error context was added to the error by dd already.
+		d.savedError = dd.savedError
+	}
+
+	return v, nil
+}
+
+// isInline reports whether a value of type t is decoded from the same JSON
+// object as its type field.
+func (do discriminatorOpts) isInline(t reflect.Type) bool {
+	if do.layout == DiscriminatorLayoutAdjacent {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Map, reflect.Struct:
+		return !marshalsItself(t)
+	}
+	return false
+}
 
-			// If the type has been discovered then it is safe to stop walking
-			// over the current JSON object.
-			if t != nil {
-				dd.opcode = scanEndObject
+// marshalsItself reports whether a value of type t, or a pointer to t,
+// implements Marshaler, MarshalerWithOptions, or encoding.TextMarshaler.
+// Such values may not be encoded as JSON objects, so they are encoded inside
+// an outer JSON object with the type and value fields even if they are maps
+// or structs.
+func marshalsItself(t reflect.Type) bool {
+	pt := cachedPointerType(t)
+	return pt.Implements(marshalerType) || pt.Implements(optionsMarshalerType) ||
+		pt.Implements(textMarshalerType)
+}
+
+// discriminatorIsObjectType reports whether a value of type t is encoded as a
+// map or struct by the map or struct encoder, following any pointers.
+func discriminatorIsObjectType(t reflect.Type) bool {
+	for {
+		if marshalsItself(t) {
+			return false
+		}
+		switch t.Kind() {
+		case reflect.Map, reflect.Struct:
+			return true
+		case reflect.Ptr:
+			t = t.Elem()
+		default:
+			return false
+		}
+	}
+}
+
+// discriminatorStripTypeField returns the JSON object data without its type
+// field, so an Unmarshaler is given the object as it was encoded before the
+// type field was added.
+func discriminatorStripTypeField(data []byte, typeFieldName string) []byte {
+	var d decodeState
+	d.init(data)
+	d.scan.reset()
+	d.scanWhile(scanSkipSpace)
+	if d.opcode != scanBeginObject {
+		return data
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, '{')
+	for {
+		// Read opening " of string key or closing }.
+		d.scanWhile(scanSkipSpace)
+		if d.opcode == scanEndObject {
+			break
+		}
+		if d.opcode != scanBeginLiteral {
+			panic(phasePanicMsg)
+		}
+
+		// Read key.
+		start := d.readIndex()
+		d.rescanLiteral()
+		key, ok := unquote(d.data[start:d.readIndex()])
+		if !ok {
+			panic(phasePanicMsg)
+		}
+
+		// Read : before value.
+		if d.opcode == scanSkipSpace {
+			d.scanWhile(scanSkipSpace)
+		}
+		if d.opcode != scanObjectKey {
+			panic(phasePanicMsg)
+		}
+		d.scanWhile(scanSkipSpace)
+
+		// Skip over the value, keeping the field unless it is the type
+		// field.
+		d.value(reflect.Value{})
+		if key != typeFieldName {
+			if len(out) > 1 {
+				out = append(out, ',')
 			}
+			out = append(out, d.data[start:d.readIndex()]...)
 		}
 
 		// Next token must be , or }.
-		if dd.opcode == scanSkipSpace {
-			dd.scanWhile(scanSkipSpace)
+		if d.opcode == scanSkipSpace {
+			d.scanWhile(scanSkipSpace)
 		}
-		if dd.opcode == scanEndObject {
+		if d.opcode == scanEndObject {
 			break
 		}
-		if dd.opcode != scanObjectValue {
+		if d.opcode != scanObjectValue {
 			panic(phasePanicMsg)
 		}
 	}
+	return append(out, '}')
+}
+
+// discriminatorParseType returns the type for the type name tn.
+func (d *decodeState) discriminatorParseType(
+	tn string, do discriminatorOpts) (reflect.Type, error) {
+
+	var registries []*TypeRegistry
+	if do.id != nil && do.id.Types != nil {
+		registries = append(registries, do.id.Types)
+	}
+	t, err := discriminatorParseTypeName(
+		tn, d.discriminatorToTypeFn, d.decodePolicy,
+		append(registries, d.discriminatorTypeRegistry)...)
+	if err != nil {
+		return nil, newTypeNameError(tn, -1, err)
+	}
+	if !do.id.isAllowed(t) {
+		return nil, newDiscriminatorError(
+			reasonTypeNotAllowed, tn, -1,
+			"json: discriminator type %s is not allowed for %s",
+			tn, do.iface)
+	}
+	return t, nil
+}
+
+// discriminatorCheckTypeName reads the type name of the JSON object that
+// begins at the offset start and is decoded into a map or struct of the type
+// t. An error is saved if the type name is not the name of t, or of a struct
+// type that embeds t.
+func (d *decodeState) discriminatorCheckTypeName(t reflect.Type, start int) {
+	valOff := d.readIndex()
+	if d.opcode != scanBeginLiteral || d.data[valOff] != '"' {
+		d.value(reflect.Value{})
+		d.saveError(d.discriminatorError(newDiscriminatorError(
+			reasonTypeNotString, "", valOff,
+			"json: discriminator type at offset %d is not string",
+			valOff), start, t))
+		return
+	}
+	d.rescanLiteral()
+	tn, ok := unquote(d.data[valOff:d.readIndex()])
+	if !ok {
+		panic(phasePanicMsg)
+	}
 
-	// If there is not a type discriminator then return early.
-	if t == nil {
-		return reflect.Value{}, fmt.Errorf("json: missing discriminator")
+	tt, err := discriminatorParseTypeName(
+		tn, d.discriminatorToTypeFn, d.decodePolicy, d.discriminatorTypeRegistry)
+	if err != nil {
+		d.saveError(d.discriminatorError(newTypeNameError(tn, valOff, err), start, t))
+		return
 	}
+	if tt.Kind() == reflect.Ptr {
+		tt = tt.Elem()
+	}
+	if tt != t && !embedsType(tt, t, nil) {
+		d.saveError(d.discriminatorError(newDiscriminatorError(
+			reasonTypeMismatch, tn, valOff,
+			"json: discriminator type %s does not match %s", tn, t), start, t))
+	}
+}
 
-	// Instantiate a new instance of the discriminated type.
-	var v reflect.Value
+// embedsType reports whether the struct type t embeds the type e, directly
+// or through the structs it embeds. The visited types are recorded so a
+// struct that embeds a pointer to itself is not visited again.
+func embedsType(t, e reflect.Type, visited map[reflect.Type]bool) bool {
+	if t.Kind() != reflect.Struct || visited[t] {
+		return false
+	}
+	if visited == nil {
+		visited = map[reflect.Type]bool{}
+	}
+	visited[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.Anonymous {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft == e || embedsType(ft, e, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// discriminatorNewValue returns a new value of the type t into which a
+// discriminated value may be decoded.
+func discriminatorNewValue(t reflect.Type) (reflect.Value, error) {
 	switch t.Kind() {
 	case reflect.Slice:
 		// MakeSlice returns a value that is not addressable.
 		// Instead, use MakeSlice to get the type, then use
 		// reflect.New to create an addressable value.
-		v = reflect.New(reflect.MakeSlice(t, 0, 0).Type()).Elem()
+		return reflect.New(reflect.MakeSlice(t, 0, 0).Type()).Elem(), nil
 	case reflect.Map:
 		// MakeMap returns a value that is not addressable.
 		// Instead, use MakeMap to get the type, then use
 		// reflect.New to create an addressable value.
-		v = reflect.New(reflect.MakeMap(t).Type()).Elem()
+		return reflect.New(reflect.MakeMap(t).Type()).Elem(), nil
 	case reflect.Complex64, reflect.Complex128:
-		return reflect.Value{}, fmt.Errorf("json: unsupported discriminator type: %s", t.Kind())
+		return reflect.Value{}, newDiscriminatorError(
+			reasonUnsupportedType, t.String(), -1,
+			"json: unsupported discriminator type: %s", t.Kind())
 	default:
-		v = reflect.New(t)
+		return reflect.New(t), nil
 	}
+}
 
-	// Reset the decode state to prepare for decoding the data.
-	dd.scan.reset()
+// discriminatorInterfaceDecode decodes the discriminated JSON object or
+// array, the first byte of which has been read already, into v, which has
+// the interface type t.
+func (d *decodeState) discriminatorInterfaceDecode(
+	t reflect.Type, v reflect.Value, do discriminatorOpts) error {
 
-	switch t.Kind() {
-	case reflect.Map, reflect.Struct:
-		// Set the offset to zero since the entire object will be decoded
-		// into v.
-		dd.off = 0
-	default:
-		// Set the offset to what it was before the discriminator value was
-		// read so only the discriminator value is decoded into v.
-		dd.off = valueOff
+	start := d.readIndex()
+	if err := d.discriminatorCount(); err != nil {
+		return d.discriminatorError(err, start, t)
 	}
-
-	// This will initialize the correct scan step and op code.
-	dd.scanWhile(scanSkipSpace)
-
-	// Decode the data into the value.
-	if err := dd.value(v); err != nil {
-		return reflect.Value{}, err
+	if err := d.discriminatorLayoutDecode(t, v, do); err != nil {
+		return d.discriminatorError(err, start, t)
 	}
-
-	return v, nil
+	return nil
 }
 
-func (d *decodeState) discriminatorInterfaceDecode(t reflect.Type, v reflect.Value) error {
+func (d *decodeState) discriminatorLayoutDecode(
+	t reflect.Type, v reflect.Value, do discriminatorOpts) error {
 
-	defer func() {
-		// Advance the decode state, throwing away the value.
-		_ = d.objectInterface()
-	}()
+	switch do.layout {
+	case DiscriminatorLayoutExternal:
+		return d.discriminatorExternalDecode(t, v, do)
+	case DiscriminatorLayoutTuple:
+		if d.opcode == scanBeginArray {
+			return d.discriminatorTupleDecode(t, v, do)
+		}
+		d.saveError(&UnmarshalTypeError{Value: "object", Type: t, Offset: int64(d.off)})
+		d.skip()
+		return nil
+	}
 
-	dv, err := d.discriminatorGetValue()
+	dv, err := d.discriminatorGetValue(do)
 	if err != nil {
 		return err
 	}
+	return discriminatorSetValue(t, v, dv)
+}
 
+// discriminatorSetValue stores the discriminated value dv, or the address
+// of dv, in v, which has the type t.
+func discriminatorSetValue(t reflect.Type, v, dv reflect.Value) error {
 	switch dv.Kind() {
 	case reflect.Map, reflect.Slice:
 		if dv.Type().AssignableTo(t) {
@@ -280,105 +850,576 @@ func (d *decodeState) discriminatorInterfaceDecode(t reflect.Type, v reflect.Val
 		}
 	}
 
-	return fmt.Errorf("json: unsupported discriminator kind: %s", dv.Kind())
+	return newDiscriminatorError(
+		reasonUnsupportedKind, dv.Type().String(), -1,
+		"json: unsupported discriminator kind: %s", dv.Kind())
 }
 
 func (o encOpts) isDiscriminatorSet() bool {
-	return o.discriminatorTypeFieldName != "" &&
-		o.discriminatorValueFieldName != ""
+	return o.discriminatorLayout.isSet(
+		o.discriminatorTypeFieldName,
+		o.discriminatorValueFieldName)
 }
 
-func discriminatorGetTypeName(t reflect.Type, mode DiscriminatorEncodeMode) string {
+// discriminatorFor returns the discriminator used to encode a value stored
+// in the type t.
+func (o encOpts) discriminatorFor(t reflect.Type) (discriminatorOpts, bool) {
+	return newDiscriminatorOpts(
+		t,
+		o.discriminatorTypeFieldName,
+		o.discriminatorValueFieldName,
+		o.discriminatorLayout,
+		o.discriminatorTypeRegistry,
+		o.discriminatorField)
+}
+
+// withoutDiscriminator returns a copy of the options with the discriminator
+// disabled.
+func (o encOpts) withoutDiscriminator() encOpts {
+	o.discriminatorTypeFieldName = ""
+	o.discriminatorValueFieldName = ""
+	o.discriminatorLayout = DiscriminatorLayoutInline
+	o.discriminatorTypeRegistry = nil
+	o.discriminatorField = fieldDiscriminator{}
+	return o
+}
+
+// isDiscriminatorObject reports whether the type name may be encoded for a
+// map or struct value.
+func (e *encodeState) isDiscriminatorObject(opts encOpts) bool {
+	return e.discriminatorEncodeTypeName ||
+		opts.discriminatorField.typed ||
+		opts.isDiscriminatorSet()
+}
+
+// discriminatorGetTypeName returns the name used to encode the type t.
+// The names of unnamed pointer, slice, array, map, and struct types are
+// derived from the names of their key, element, and field types so they may
+// be parsed by discriminatorParseTypeName. A false value is returned if the
+// type is not registered and the encode mode requires all types to be
+// registered.
+func discriminatorGetTypeName(t reflect.Type, opts encOpts) (string, bool) {
+	return discriminatorTypeName(t, opts, false)
+}
+
+// discriminatorTypeName is like discriminatorGetTypeName, but elem indicates
+// t is the key, element, or field type of an unnamed type.
+func discriminatorTypeName(t reflect.Type, opts encOpts, elem bool) (string, bool) {
+	if tn, ok := opts.discriminatorInterfaceTypes.nameOf(t); ok {
+		return tn, true
+	}
+	if fn := opts.discriminatorTypeNameFn; fn != nil {
+		if tn, ok := fn(t); ok {
+			return tn, true
+		}
+	}
+	if tn, ok := opts.discriminatorTypeRegistry.NameOf(t); ok {
+		return tn, true
+	}
+	mode := opts.discriminatorEncodeMode
+	if tn := t.Name(); tn != "" {
+		if mode.registeredOnly() {
+			return "", false
+		}
+		if tn, ok := cachedDefinedTypeName(t); ok {
+			return tn, true
+		}
+		if elem && mode.qualifiedElems() {
+			return t.String(), true
+		}
+		if !mode.typeArgsWithPath() {
+			tn = cachedShortTypeName(t)
+		}
+		if mode.withPath() {
+			if pp := t.PkgPath(); pp != "" {
+				return fmt.Sprintf("%s.%s", pp, tn), true
+			}
+		}
+		return tn, true
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		etn, ok := discriminatorTypeName(t.Elem(), opts, true)
+		return "*" + etn, ok
+	case reflect.Slice:
+		etn, ok := discriminatorTypeName(t.Elem(), opts, true)
+		return "[]" + etn, ok
+	case reflect.Array:
+		etn, ok := discriminatorTypeName(t.Elem(), opts, true)
+		return "[" + strconv.Itoa(t.Len()) + "]" + etn, ok
+	case reflect.Map:
+		ktn, kok := discriminatorTypeName(t.Key(), opts, true)
+		etn, eok := discriminatorTypeName(t.Elem(), opts, true)
+		return "map[" + ktn + "]" + etn, kok && eok
+	case reflect.Struct:
+		return discriminatorStructTypeName(t, opts)
+	}
+	if mode.registeredOnly() {
+		return "", false
+	}
+	return t.String(), true
+}
+
+// discriminatorStructTypeName returns the name of the unnamed struct type
+// t. The name is written like the String method of t, ex.
+// `struct { A int "json:\"a\""; Foo }`, but with the type names of the
+// fields so it may be parsed by discriminatorParseTypeName. The name of an
+// unexported field is written even if the field is embedded, so the type
+// name cannot be parsed since the type cannot be constructed.
+func discriminatorStructTypeName(t reflect.Type, opts encOpts) (string, bool) {
+	fields := cachedStructTypeNameFields(t)
+	if len(fields) == 0 {
+		return "struct {}", true
+	}
+	var b strings.Builder
+	ok := true
+	b.WriteString("struct { ")
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(f.name)
+		ftn, fok := discriminatorTypeName(f.typ, opts, true)
+		b.WriteString(ftn)
+		ok = ok && fok
+		b.WriteString(f.tag)
+	}
+	b.WriteString(" }")
+	return b.String(), ok
+}
+
+// A structTypeNameField holds the parts of the name of a field of an unnamed
+// struct type that do not depend on the encode options.
+type structTypeNameField struct {
+	name string       // the field name and a space, or empty if embedded
+	typ  reflect.Type // the field type
+	tag  string       // a space and the quoted tag, or empty if untagged
+}
+
+// discriminatorStructTypeNameCache caches the fields written to the names of
+// unnamed struct types. The names themselves are not cached since the type
+// names of the fields depend on the encode options.
+var discriminatorStructTypeNameCache sync.Map // map[reflect.Type][]structTypeNameField
+
+// cachedStructTypeNameFields returns the fields written to the name of the
+// unnamed struct type t.
+func cachedStructTypeNameFields(t reflect.Type) []structTypeNameField {
+	if value, ok := discriminatorStructTypeNameCache.Load(t); ok {
+		return value.([]structTypeNameField)
+	}
+	fields := make([]structTypeNameField, t.NumField())
+	for i := range fields {
+		f := t.Field(i)
+		if !f.Anonymous || f.PkgPath != "" {
+			fields[i].name = f.Name + " "
+		}
+		fields[i].typ = f.Type
+		if f.Tag != "" {
+			fields[i].tag = " " + strconv.Quote(string(f.Tag))
+		}
+	}
+	value, _ := discriminatorStructTypeNameCache.LoadOrStore(t, fields)
+	return value.([]structTypeNameField)
+}
+
+var typeNamerType = reflect.TypeOf((*TypeNamer)(nil)).Elem()
+
+// discriminatorDefinedTypeNameCache caches the type names defined by types
+// with a JSONTypeName method or a "jsontype" struct tag.
+var discriminatorDefinedTypeNameCache sync.Map // map[reflect.Type]string
+
+// cachedDefinedTypeName returns the type name defined by the type t with a
+// JSONTypeName method or a "jsontype" struct tag. A false value is returned
+// if t does not define its type name.
+func cachedDefinedTypeName(t reflect.Type) (string, bool) {
+	if value, ok := discriminatorDefinedTypeNameCache.Load(t); ok {
+		tn := value.(string)
+		return tn, tn != ""
+	}
+	tn := definedTypeName(t)
+	discriminatorDefinedTypeNameCache.Store(t, tn)
+	return tn, tn != ""
+}
+
+func definedTypeName(t reflect.Type) string {
+	if t.Kind() == reflect.Interface {
+		return ""
+	}
+	if t.Implements(typeNamerType) {
+		return reflect.Zero(t).Interface().(TypeNamer).JSONTypeName()
+	}
+	if t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(typeNamerType) {
+		return reflect.New(t).Interface().(TypeNamer).JSONTypeName()
+	}
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Name != "_" {
+			continue
+		}
+		if name := sf.Tag.Get("jsontype"); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// discriminatorMustGetTypeName returns the name of the type t, or aborts the
+// encoding if the type is not registered. If parseable is true, ex. for a
+// value stored in an interface, the encoding is also aborted if the name
+// cannot be parsed when it is decoded. The name of a map or struct that is
+// not stored in an interface is not used to decode it, so it is encoded as
+// is. A false value is returned instead if the name cannot be parsed and the
+// encode mode omits such names.
+func discriminatorMustGetTypeName(
+	e *encodeState, t reflect.Type, opts encOpts, parseable bool) (string, bool) {
+
+	tn, ok := discriminatorGetTypeName(t, opts)
+	if !ok {
+		e.error(fmt.Errorf("json: discriminator type not registered: %s", t))
+	}
+	omit := opts.discriminatorEncodeMode.omitUnparseable()
+	if (parseable || omit) && !cachedIsValidTypeName(tn) {
+		if omit {
+			return "", false
+		}
+		e.error(fmt.Errorf("json: discriminator type name %q of %s cannot be parsed", tn, t))
+	}
+	return tn, true
+}
+
+// discriminatorShortTypeNameCache caches the names of instantiated generic
+// types without the package paths of their type arguments.
+var discriminatorShortTypeNameCache sync.Map // map[reflect.Type]string
+
+// cachedShortTypeName returns the name of the type t without the package
+// paths of its type arguments, if any.
+func cachedShortTypeName(t reflect.Type) string {
 	tn := t.Name()
-	if tn == "" {
-		return t.String()
+	if strings.IndexByte(tn, '[') < 0 {
+		return tn
 	}
-	if mode.withPath() {
-		if pp := t.PkgPath(); pp != "" {
-			return fmt.Sprintf("%s.%s", pp, tn)
+	if value, ok := discriminatorShortTypeNameCache.Load(t); ok {
+		return value.(string)
+	}
+	value, _ := discriminatorShortTypeNameCache.LoadOrStore(t, shortTypeName(tn))
+	return value.(string)
+}
+
+// shortTypeName returns the name of the instantiated generic type tn with
+// the package paths removed from its type arguments, ex. "Pair[string,Foo]"
+// for "Pair[string,example.com/pkg.Foo]".
+func shortTypeName(tn string) string {
+	i := strings.IndexByte(tn, '[')
+	if i < 0 {
+		return tn
+	}
+	var b strings.Builder
+	b.WriteString(tn[:i])
+	for s := tn[i:]; s != ""; {
+		n := 0
+		for n < len(s) && isQualifiedIdentByte(s[n]) {
+			n++
+		}
+		if n == 0 {
+			b.WriteByte(s[0])
+			s = s[1:]
+			continue
+		}
+		ident := s[:n]
+		s = s[n:]
+
+		// Preserve the ellipsis of a variadic parameter, ex. "...int".
+		j := len(ident) - len(strings.TrimLeft(ident, "."))
+		b.WriteString(ident[:j])
+		ident = ident[j:]
+
+		if j := strings.LastIndexByte(ident, '.'); j >= 0 {
+			ident = ident[j+1:]
 		}
+		b.WriteString(ident)
 	}
-	return tn
+	return b.String()
+}
+
+// isQualifiedIdentByte reports whether c may be part of an identifier that
+// is qualified with a package path.
+func isQualifiedIdentByte(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '_' || c == '.' || c == '/' || c == '-' || c == '%' || c == '~' ||
+		c >= utf8.RuneSelf
 }
 
-func discriminatorInterfaceEncode(e *encodeState, v reflect.Value, opts encOpts) {
+// discriminatorWriteTypeField writes the type field for the type name tn,
+// not including the leading { or , character.
+func discriminatorWriteTypeField(e *encodeState, typeFieldName, tn string, opts encOpts) {
+	e.WriteByte('"')
+	e.WriteString(typeFieldName)
+	e.WriteString(`":`)
+	e.string(tn, opts.escapeHTML)
+}
+
+func discriminatorInterfaceEncode(
+	e *encodeState, v reflect.Value, opts encOpts, do discriminatorOpts) {
+
+	// A non-nil pointer is encoded as the value to which it points unless
+	// the encode mode preserves pointers. A nil pointer is encoded with the
+	// name of the pointer type and a null value, ex. {"_t":"*Dog","_v":null},
+	// so it is decoded as a typed nil rather than a nil interface.
 	v = v.Elem()
+	if v.Kind() == reflect.Ptr && !v.IsNil() &&
+		(!opts.discriminatorEncodeMode.pointers() || v.Type().Elem() == unknownDiscriminatedType) {
+		discriminatorInterfaceEncode(e, v, opts, do)
+		return
+	}
+
+	// A placeholder for a value of an unknown type is encoded as the
+	// original JSON value.
+	if v.Type() == unknownDiscriminatedType {
+		discriminatorUnknownEncode(e, v)
+		return
+	}
+
 	switch v.Kind() {
 	case reflect.Chan, reflect.Func, reflect.Invalid:
 		e.error(&UnsupportedValueError{v, fmt.Sprintf("invalid kind: %s", v.Kind())})
-	case reflect.Map:
-		e.discriminatorEncodeTypeName = true
-		newMapEncoder(v.Type())(e, v, opts)
-	case reflect.Struct:
-		e.discriminatorEncodeTypeName = true
-		newStructEncoder(v.Type())(e, v, opts)
-	case reflect.Ptr:
-		discriminatorInterfaceEncode(e, v, opts)
-	default:
-		e.WriteString(`{"`)
-		e.WriteString(opts.discriminatorTypeFieldName)
-		e.WriteString(`":"`)
-		e.WriteString(discriminatorGetTypeName(v.Type(), opts.discriminatorEncodeMode))
-		e.WriteString(`","`)
-		e.WriteString(opts.discriminatorValueFieldName)
-		e.WriteString(`":`)
+	}
+
+	if !do.id.isAllowed(v.Type()) {
+		e.error(fmt.Errorf(
+			"json: discriminator type %s is not allowed for %s",
+			v.Type(), do.iface))
+	}
+
+	// The interface's registry is used only to get the name of the value's
+	// type, and not the names of any types nested in the value.
+	topts := opts
+	if do.id != nil {
+		topts.discriminatorInterfaceTypes = do.id.Types
+	}
+	tn, ok := discriminatorMustGetTypeName(e, v.Type(), topts, true)
+
+	// The field options apply only to the value stored in the interface.
+	opts.discriminatorField = fieldDiscriminator{}
+
+	// A value without a type name is encoded as if it were not stored in
+	// an interface.
+	if !ok {
+		e.reflectValue(v, opts)
+		return
+	}
+
+	switch do.layout {
+	case DiscriminatorLayoutExternal:
+		e.WriteByte('{')
+		e.string(tn, opts.escapeHTML)
+		e.WriteByte(':')
 		e.reflectValue(v, opts)
 		e.WriteByte('}')
+		return
+	case DiscriminatorLayoutTuple:
+		e.WriteByte('[')
+		e.string(tn, opts.escapeHTML)
+		e.WriteByte(',')
+		e.reflectValue(v, opts)
+		e.WriteByte(']')
+		return
+	case DiscriminatorLayoutInline:
+		if marshalsItself(v.Type()) {
+			break
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			if v.IsNil() {
+				break
+			}
+			discriminatorInlineEncode(e, newMapEncoder(v.Type()), v, opts,
+				do.typeFieldName, tn, do.valueFieldName)
+			return
+		case reflect.Struct:
+			discriminatorInlineEncode(e, newStructEncoder(v.Type()), v, opts,
+				do.typeFieldName, tn, "")
+			return
+		}
 	}
+
+	// All other values, including pointers, nil maps, the values encoded by
+	// a Marshaler or encoding.TextMarshaler, and all values when the layout
+	// is adjacent, are encoded inside an outer JSON object. A nil map is
+	// encoded like a nil pointer, ex. {"_t":"map[string]int","_v":null}, so
+	// it is decoded as a typed nil rather than a nil interface.
+	e.WriteByte('{')
+	discriminatorWriteTypeField(e, do.typeFieldName, tn, opts)
+	e.WriteString(`,"`)
+	e.WriteString(do.valueFieldName)
+	e.WriteString(`":`)
+	e.reflectValue(v, opts)
+	e.WriteByte('}')
 }
 
-func discriminatorMapEncode(e *encodeState, v reflect.Value, opts encOpts) {
-	if !e.discriminatorEncodeTypeName && !opts.discriminatorEncodeMode.all() {
-		return
+// discriminatorInlineEncode encodes the map or struct value v with enc,
+// writing the type field as the first field of the value's JSON object. The
+// state used to pass the type field to enc is reset afterwards so the type
+// name is never encoded along with a subsequent value. The keys of a map
+// that collide with valueFieldName are escaped, as a map with only a null
+// value field is decoded as a nil map.
+func discriminatorInlineEncode(
+	e *encodeState, enc encoderFunc, v reflect.Value, opts encOpts,
+	typeFieldName, tn, valueFieldName string) {
+
+	e.discriminatorEncodeTypeName = true
+	e.discriminatorTypeFieldName = typeFieldName
+	e.discriminatorTypeName = tn
+	e.discriminatorValueFieldName = valueFieldName
+	enc(e, v, opts)
+	e.discriminatorEncodeTypeName = false
+	e.discriminatorTypeFieldName = ""
+	e.discriminatorTypeName = ""
+	e.discriminatorValueFieldName = ""
+}
+
+// discriminatorObjectTypeField returns the type field name and type name
+// that should be encoded for the map or struct value v. A false value is
+// returned if the type name should not be encoded.
+func discriminatorObjectTypeField(
+	e *encodeState, v reflect.Value, opts encOpts) (string, string, bool) {
+
+	if e.discriminatorEncodeTypeName {
+		e.discriminatorEncodeTypeName = false
+		return e.discriminatorTypeFieldName, e.discriminatorTypeName, true
 	}
-	e.WriteByte('"')
-	e.WriteString(opts.discriminatorTypeFieldName)
-	e.WriteString(`":"`)
-	e.WriteString(discriminatorGetTypeName(v.Type(), opts.discriminatorEncodeMode))
-	e.WriteByte('"')
+	if e.discriminatorOmitTypeName {
+		e.discriminatorOmitTypeName = false
+		return "", "", false
+	}
+	if opts.discriminatorLayout != DiscriminatorLayoutInline {
+		return "", "", false
+	}
+	if fd := opts.discriminatorField; fd.typed {
+		typeFieldName := opts.discriminatorTypeFieldName
+		if fd.typeFieldName != "" {
+			typeFieldName = fd.typeFieldName
+		}
+		if typeFieldName != "" {
+			tn, ok := discriminatorMustGetTypeName(e, v.Type(), opts, false)
+			return typeFieldName, tn, ok
+		}
+	}
+	if opts.isDiscriminatorSet() && opts.discriminatorEncodeMode.all() {
+		tn, ok := discriminatorMustGetTypeName(e, v.Type(), opts, false)
+		return opts.discriminatorTypeFieldName, tn, ok
+	}
+	return "", "", false
+}
+
+// discriminatorMapEncode writes the type field for the map value v, if any.
+// It returns the name of the type field that is skipped when the JSON object
+// is decoded into a map, and the name of the value field of the interface in
+// which v is stored, if any, so the keys of v that collide with them are
+// escaped.
+func discriminatorMapEncode(
+	e *encodeState, v reflect.Value, opts encOpts) (string, string) {
+
+	valueFieldName := e.discriminatorValueFieldName
+	e.discriminatorValueFieldName = ""
+	typeFieldName, tn, ok := discriminatorObjectTypeField(e, v, opts)
+	if !ok {
+		if opts.discriminatorLayout != DiscriminatorLayoutInline {
+			return "", ""
+		}
+		if fd := opts.discriminatorField; fd.typed && fd.typeFieldName != "" {
+			return fd.typeFieldName, ""
+		}
+		if opts.isDiscriminatorSet() {
+			return opts.discriminatorTypeFieldName, ""
+		}
+		return "", ""
+	}
+	discriminatorWriteTypeField(e, typeFieldName, tn, opts)
 	if v.Len() > 0 {
 		e.WriteByte(',')
 	}
-	e.discriminatorEncodeTypeName = false
+	return typeFieldName, valueFieldName
 }
 
+// discriminatorStructEncode writes the opening brace and the type field for
+// the struct value v, if any, and returns the byte that should be written
+// before the struct's first field. An error is returned if the type field
+// has the same name as one of the struct's fields.
 func discriminatorStructEncode(e *encodeState, v reflect.Value, opts encOpts) byte {
-	if !e.discriminatorEncodeTypeName && !opts.discriminatorEncodeMode.all() {
+	typeFieldName, tn, ok := discriminatorObjectTypeField(e, v, opts)
+	if !ok {
 		return '{'
 	}
-	e.WriteString(`{"`)
-	e.WriteString(opts.discriminatorTypeFieldName)
-	e.WriteString(`":"`)
-	e.WriteString(discriminatorGetTypeName(v.Type(), opts.discriminatorEncodeMode))
-	e.WriteByte('"')
-	e.discriminatorEncodeTypeName = false
+	if err := cachedTypeFieldCollision(v.Type(), typeFieldName); err != nil {
+		e.error(err)
+	}
+	e.WriteByte('{')
+	discriminatorWriteTypeField(e, typeFieldName, tn, opts)
 	return ','
 }
 
-var discriminatorTypeRegistry = map[string]reflect.Type{
-	"uint":         reflect.TypeOf(uint(0)),
-	"uint8":        reflect.TypeOf(uint8(0)),
-	"uint16":       reflect.TypeOf(uint16(0)),
-	"uint32":       reflect.TypeOf(uint32(0)),
-	"uint64":       reflect.TypeOf(uint64(0)),
-	"uintptr":      reflect.TypeOf(uintptr(0)),
-	"int":          reflect.TypeOf(int(0)),
-	"int8":         reflect.TypeOf(int8(0)),
-	"int16":        reflect.TypeOf(int16(0)),
-	"int32":        reflect.TypeOf(int32(0)),
-	"int64":        reflect.TypeOf(int64(0)),
-	"float32":      reflect.TypeOf(float32(0)),
-	"float64":      reflect.TypeOf(float64(0)),
-	"bool":         reflect.TypeOf(true),
-	"string":       reflect.TypeOf(""),
-	"any":          reflect.TypeOf((*interface{})(nil)).Elem(),
-	"interface{}":  reflect.TypeOf((*interface{})(nil)).Elem(),
-	"interface {}": reflect.TypeOf((*interface{})(nil)).Elem(),
-
-	// Not supported, but here to prevent the decoder from panicing
-	// if encountered.
-	"complex64":  reflect.TypeOf(complex64(0)),
-	"complex128": reflect.TypeOf(complex128(0)),
+// discriminatorCollisionKey is the key of discriminatorCollisionCache.
+type discriminatorCollisionKey struct {
+	t             reflect.Type
+	typeFieldName string
+}
+
+// discriminatorCollisionCache caches the errors returned by
+// cachedTypeFieldCollision.
+var discriminatorCollisionCache sync.Map // map[discriminatorCollisionKey]error
+
+// cachedTypeFieldCollision returns an error if the type field has the same
+// name as one of the fields of the struct type t, since the type field and
+// the struct field cannot both be encoded or decoded. The names are compared
+// the same way a key is matched to a field when decoding. The result is
+// computed along with the fields of t the first time the type field is
+// used with t.
+func cachedTypeFieldCollision(t reflect.Type, typeFieldName string) error {
+	key := discriminatorCollisionKey{t, typeFieldName}
+	if value, ok := discriminatorCollisionCache.Load(key); ok {
+		err, _ := value.(error)
+		return err
+	}
+	var err error
+	fields := cachedTypeFields(t)
+	name := []byte(typeFieldName)
+	for i := range fields.list {
+		if f := &fields.list[i]; f.name == typeFieldName || f.equalFold(f.nameBytes, name) {
+			err = fmt.Errorf(
+				"json: discriminator type field %q collides with a field of %s",
+				typeFieldName, t)
+			break
+		}
+	}
+	discriminatorCollisionCache.Store(key, err)
+	return err
+}
+
+// discriminatorKeyPrefix escapes a map key that collides with the type field
+// of the JSON object for the map, ex. the key "_typeName" is encoded as
+// "__typeName" when the type field is "_typeName". The prefix is also added
+// to a key that is already escaped, ex. "__typeName" is encoded as
+// "___typeName", so the keys of any map are decoded as they were encoded.
+const discriminatorKeyPrefix = "_"
+
+// discriminatorUnescapeKey returns the quoted map key item without its
+// escape prefix, which may itself be escaped in the JSON string.
+func discriminatorUnescapeKey(item []byte) []byte {
+	n := len(discriminatorKeyPrefix)
+	if item[1] == '\\' {
+		n = len(`\u005f`)
+	}
+	return append([]byte{'"'}, item[1+n:]...)
+}
+
+// isDiscriminatorKey reports whether key is the type field name, with or
+// without any number of escape prefixes.
+func isDiscriminatorKey(key, typeFieldName string) bool {
+	return strings.HasSuffix(key, typeFieldName) &&
+		strings.Trim(key[:len(key)-len(typeFieldName)], discriminatorKeyPrefix) == ""
 }
 
 // discriminatorPointerTypeCache caches the pointer type for another type.
@@ -397,104 +1438,35 @@ func cachedPointerType(t reflect.Type) reflect.Type {
 	return value.(reflect.Type)
 }
 
-var (
-	mapPatt   = regexp.MustCompile(`^\*?map\[([^\]]+)\](.+)$`)
-	arrayPatt = regexp.MustCompile(`^\*?\[(\d+)\](.+)$`)
-	slicePatt = regexp.MustCompile(`^\*?\[\](.+)$`)
-)
-
 // discriminatorParseTypeName returns a reflect.Type for the given type name.
+// The registries are searched in order before the optional typeFn, and a
+// PolicyError is returned if the type may not be constructed by the policy.
+// Please see typeNameParser for the syntax of type names.
 func discriminatorParseTypeName(
 	typeName string,
-	typeFn DiscriminatorToTypeFunc) (reflect.Type, error) {
-
-	// Check to see if the type is an array, map, or slice.
-	var (
-		aln = -1   // array length
-		etn string // map or slice element type name
-		ktn string // map key type name
-	)
-	if m := arrayPatt.FindStringSubmatch(typeName); len(m) > 0 {
-		i, err := strconv.Atoi(m[1])
-		if err != nil {
-			return nil, err
-		}
-		aln = i
-		etn = m[2]
-	} else if m := slicePatt.FindStringSubmatch(typeName); len(m) > 0 {
-		etn = m[1]
-	} else if m := mapPatt.FindStringSubmatch(typeName); len(m) > 0 {
-		ktn = m[1]
-		etn = m[2]
-	}
-
-	// indirectTypeName checks to see if the type name begins with a
-	// "*" characters. If it does, then the type name sans the "*"
-	// character is returned along with a true value indicating the
-	// type is a pointer. Otherwise the original type name is returned
-	// along with a false value.
-	indirectTypeName := func(tn string) (string, bool) {
-		if len(tn) > 1 && tn[0] == '*' {
-			return tn[1:], true
-		}
-		return tn, false
-	}
+	typeFn DiscriminatorToTypeFunc,
+	policy DecodePolicy,
+	registries ...*TypeRegistry) (reflect.Type, error) {
 
 	lookupType := func(tn string) (reflect.Type, bool) {
-		// Get the actual type name and a flag indicating whether the
-		// type is a pointer.
-		n, p := indirectTypeName(tn)
-
-		// First look up the type in the built-in type registry.
-		t, ok := discriminatorTypeRegistry[n]
-		if !ok {
-			// If not found in the type registry then see if the type
-			// is returne from the optional type function.
-			if typeFn == nil {
-				return nil, false
-			}
-			if t, ok = typeFn(n); !ok {
-				return nil, false
-			}
-		}
-		// If the type was a pointer then get the type's pointer type.
-		if p {
-			t = cachedPointerType(t)
-		}
-		return t, true
-	}
-
-	var t reflect.Type
-
-	if ktn == "" && etn != "" {
-		et, ok := lookupType(etn)
-		if !ok {
-			return nil, fmt.Errorf("json: invalid array/slice element type: %s", etn)
-		}
-		if aln > -1 {
-			// Array
-			t = reflect.ArrayOf(aln, et)
-		} else {
-			// Slice
-			t = reflect.SliceOf(et)
-		}
-	} else if ktn != "" && etn != "" {
-		// Map
-		kt, ok := lookupType(ktn)
-		if !ok {
-			return nil, fmt.Errorf("json: invalid map key type: %s", ktn)
+		// First look up the type in the type registries, which always
+		// include the built-in types.
+		if t, ok := builtinTypeRegistry.typeOf(tn); ok {
+			return t, true
 		}
-		et, ok := lookupType(etn)
-		if !ok {
-			return nil, fmt.Errorf("json: invalid map element type: %s", etn)
+		for _, r := range registries {
+			if t, ok := r.typeOf(tn); ok {
+				return t, true
+			}
 		}
-		t = reflect.MapOf(kt, et)
-	} else {
-		var ok bool
-		if t, ok = lookupType(typeName); !ok {
-			return nil, fmt.Errorf("json: invalid discriminator type: %s", typeName)
+		// If not found in the type registry then see if the type is
+		// returned from the optional type function.
+		if typeFn == nil {
+			return nil, false
 		}
+		return typeFn(tn)
 	}
 
-	return t, nil
+	p := typeNameParser{s: typeName, policy: policy, lookup: lookupType}
+	return p.parse()
 }
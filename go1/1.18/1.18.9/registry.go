@@ -0,0 +1,232 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// A TypeRegistry maps type names to Go types and Go types to type names so
+// the type names written by an Encoder are the same type names understood by
+// a Decoder.
+//
+// A TypeRegistry may be composed of other registries, ex. one per package,
+// and every TypeRegistry includes the built-in types supported by the
+// discriminator as its base layer.
+//
+// A TypeRegistry is safe for concurrent use by multiple goroutines.
+type TypeRegistry struct {
+	mu         sync.RWMutex
+	types      map[string]reflect.Type                  // type name or alias -> type
+	names      map[reflect.Type]string                  // type -> type name
+	interfaces map[reflect.Type]*InterfaceDiscriminator // interface type -> config
+	parents    []*TypeRegistry
+}
+
+// NewTypeRegistry returns a new TypeRegistry. Type names that are not found
+// in the new registry are looked up in the parent registries in the order
+// in which they were provided.
+func NewTypeRegistry(parents ...*TypeRegistry) *TypeRegistry {
+	return &TypeRegistry{
+		types:      map[string]reflect.Type{},
+		names:      map[reflect.Type]string{},
+		interfaces: map[reflect.Type]*InterfaceDiscriminator{},
+		parents:    parents,
+	}
+}
+
+// Register registers the type t with the provided name and optional
+// aliases. The name is used when encoding values of type t, and the name
+// and any of the aliases may be used to decode values of type t.
+// If name is empty then the name the encoder would use by default for t
+// is registered instead, along with the names prefixed with full package
+// paths as aliases, ex. "Foo" and "example.com/pkg.Foo".
+// An error is returned if the name or one of the aliases is already
+// registered to a different type, or if t is already registered with a
+// different name.
+func (r *TypeRegistry) Register(t reflect.Type, name string, aliases ...string) error {
+	if t == nil {
+		return fmt.Errorf("json: cannot register nil type")
+	}
+	if name == "" {
+		name, _ = discriminatorGetTypeName(t, encOpts{})
+		aliases = aliases[:len(aliases):len(aliases)]
+		for _, mode := range []DiscriminatorEncodeMode{
+			DiscriminatorEncodeTypeNameTypeArgsWithPath,
+			DiscriminatorEncodeTypeNameWithPath,
+		} {
+			alias, _ := discriminatorGetTypeName(t, encOpts{
+				discriminatorEncodeMode: mode,
+			})
+			if alias != name {
+				aliases = append(aliases, alias)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if n, ok := r.names[t]; ok && n != name {
+		return fmt.Errorf("json: type %s already registered as %q", t, n)
+	}
+	names := append([]string{name}, aliases...)
+	for _, n := range names {
+		if n == "" {
+			return fmt.Errorf("json: cannot register empty type name for %s", t)
+		}
+		if bt, ok := builtinTypeRegistry.types[n]; ok && bt != t {
+			return fmt.Errorf("json: type name %q is reserved for built-in type %s", n, bt)
+		}
+		if rt, ok := r.types[n]; ok && rt != t {
+			return fmt.Errorf("json: type name %q already registered to %s", n, rt)
+		}
+	}
+	for _, n := range names {
+		r.types[n] = t
+	}
+	r.names[t] = name
+	return nil
+}
+
+// TypeOf returns the type registered with the provided name or alias.
+func (r *TypeRegistry) TypeOf(name string) (reflect.Type, bool) {
+	if t, ok := builtinTypeRegistry.types[name]; ok {
+		return t, true
+	}
+	return r.typeOf(name)
+}
+
+func (r *TypeRegistry) typeOf(name string) (reflect.Type, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	t, ok := r.types[name]
+	r.mu.RUnlock()
+	if ok {
+		return t, true
+	}
+	for _, p := range r.parents {
+		if t, ok := p.typeOf(name); ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// NameOf returns the name with which the type t is registered.
+func (r *TypeRegistry) NameOf(t reflect.Type) (string, bool) {
+	if n, ok := builtinTypeRegistry.names[t]; ok {
+		return n, true
+	}
+	return r.nameOf(t)
+}
+
+func (r *TypeRegistry) nameOf(t reflect.Type) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	r.mu.RLock()
+	n, ok := r.names[t]
+	r.mu.RUnlock()
+	if ok {
+		return n, true
+	}
+	for _, p := range r.parents {
+		if n, ok := p.nameOf(t); ok {
+			return n, true
+		}
+	}
+	return "", false
+}
+
+// RegisterInterface registers the discriminator used to encode and decode
+// the values stored in the interface type t.
+// An error is returned if t is not an interface type, if t is already
+// registered, or if one of the allowed types or the default type does not
+// implement t.
+func (r *TypeRegistry) RegisterInterface(t reflect.Type, d InterfaceDiscriminator) error {
+	if t == nil || t.Kind() != reflect.Interface {
+		return fmt.Errorf("json: cannot register non-interface type %v", t)
+	}
+	for _, at := range d.AllowedTypes {
+		if at == nil || !(at.Implements(t) || reflect.PtrTo(at).Implements(t)) {
+			return fmt.Errorf("json: allowed type %v does not implement %s", at, t)
+		}
+	}
+	if dt := d.DefaultType; dt != nil {
+		if !(dt.Implements(t) || reflect.PtrTo(dt).Implements(t)) {
+			return fmt.Errorf("json: default type %s does not implement %s", dt, t)
+		}
+		if !d.isAllowed(dt) {
+			return fmt.Errorf("json: default type %s is not allowed for %s", dt, t)
+		}
+	}
+	d.AllowedTypes = append([]reflect.Type(nil), d.AllowedTypes...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.interfaces[t]; ok {
+		return fmt.Errorf("json: interface %s already registered", t)
+	}
+	r.interfaces[t] = &d
+	return nil
+}
+
+// interfaceOf returns the discriminator registered for the interface type t.
+func (r *TypeRegistry) interfaceOf(t reflect.Type) (*InterfaceDiscriminator, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	d, ok := r.interfaces[t]
+	r.mu.RUnlock()
+	if ok {
+		return d, true
+	}
+	for _, p := range r.parents {
+		if d, ok := p.interfaceOf(t); ok {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// TypeFunc returns a DiscriminatorToTypeFunc that looks up types in the
+// registry.
+func (r *TypeRegistry) TypeFunc() DiscriminatorToTypeFunc {
+	return r.TypeOf
+}
+
+// builtinTypeRegistry is the base layer of every TypeRegistry and contains
+// the built-in types supported by the discriminator. It is never modified
+// after it is initialized.
+var builtinTypeRegistry = func() *TypeRegistry {
+	r := NewTypeRegistry()
+	for _, v := range []interface{}{
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		float32(0), float64(0),
+		true,
+		"",
+
+		// Not supported, but here to prevent the decoder from panicing
+		// if encountered.
+		complex64(0), complex128(0),
+	} {
+		t := reflect.TypeOf(v)
+		r.types[t.Name()] = t
+		r.names[t] = t.Name()
+	}
+	r.types["any"] = interfaceType
+	r.types["interface{}"] = interfaceType
+	r.types["interface {}"] = interfaceType
+	r.names[interfaceType] = "interface {}"
+	return r
+}()
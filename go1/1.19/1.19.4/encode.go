@@ -300,6 +300,18 @@ type encodeState struct {
 	// to false as soon as the type name is encoded to prevent impacting
 	// subsequent values.
 	discriminatorEncodeTypeName bool
+	// discriminatorTypeFieldName and discriminatorTypeName are the field
+	// name and type name encoded when discriminatorEncodeTypeName is true.
+	discriminatorTypeFieldName string
+	discriminatorTypeName      string
+	// discriminatorValueFieldName is the value field name of the interface
+	// in which a map is stored when discriminatorEncodeTypeName is true.
+	discriminatorValueFieldName string
+	// discriminatorOmitTypeName is set to true when the type name should not
+	// be encoded for the map or struct value at the root of a value encoded
+	// by a MarshalerWithOptions. The flag is flipped back to false as soon as
+	// the map or struct is encoded.
+	discriminatorOmitTypeName bool
 }
 
 const startDetectingCyclesAfter = 1000
@@ -315,6 +327,8 @@ func newEncodeState() *encodeState {
 		}
 		e.ptrLevel = 0
 		e.discriminatorEncodeTypeName = false
+		e.discriminatorValueFieldName = ""
+		e.discriminatorOmitTypeName = false
 		return e
 	}
 	return &encodeState{ptrSeen: make(map[any]struct{})}
@@ -339,8 +353,15 @@ func (e *encodeState) marshal(v any, opts encOpts) (err error) {
 	}()
 
 	val := reflect.ValueOf(v)
-	if val.IsValid() && opts.isDiscriminatorSet() && opts.discriminatorEncodeMode.root() {
-		val = val.Convert(interfaceType)
+	if val.IsValid() && opts.isDiscriminatorSet() {
+		if opts.discriminatorNested {
+			// The value is encoded inside the value of a type that marshals
+			// itself, ex. as an alias of the type, so it is not the root value
+			// and the name of the alias is not encoded.
+			e.discriminatorOmitTypeName = discriminatorIsObjectType(val.Type())
+		} else if opts.discriminatorEncodeMode.root() {
+			val = val.Convert(interfaceType)
+		}
 	}
 	e.reflectValue(val, opts)
 
@@ -387,6 +408,20 @@ type encOpts struct {
 	discriminatorValueFieldName string
 	// see Encoder.SetDiscriminator
 	discriminatorEncodeMode DiscriminatorEncodeMode
+	// see Encoder.SetTypeRegistry
+	discriminatorTypeRegistry *TypeRegistry
+	// see Encoder.SetTypeNameFunc
+	discriminatorTypeNameFn TypeToDiscriminatorFunc
+	// see Encoder.SetDiscriminatorLayout
+	discriminatorLayout DiscriminatorLayout
+	// see InterfaceDiscriminator.Types
+	discriminatorInterfaceTypes *TypeRegistry
+	// discriminatorField holds the discriminator options of the struct
+	// field being encoded.
+	discriminatorField fieldDiscriminator
+	// discriminatorNested is set when the value is encoded by a
+	// MarshalerWithOptions.
+	discriminatorNested bool
 }
 
 type encoderFunc func(e *encodeState, v reflect.Value, opts encOpts)
@@ -441,6 +476,12 @@ func newTypeEncoder(t reflect.Type, allowAddr bool) encoderFunc {
 	// Marshaler with a value receiver, then we're better off taking
 	// the address of the value - otherwise we end up with an
 	// allocation as we cast the value to an interface.
+	if t.Kind() != reflect.Pointer && allowAddr && reflect.PointerTo(t).Implements(optionsMarshalerType) {
+		return newCondAddrEncoder(addrOptionsMarshalerEncoder, newTypeEncoder(t, false))
+	}
+	if t.Implements(optionsMarshalerType) {
+		return optionsMarshalerEncoder
+	}
 	if t.Kind() != reflect.Pointer && allowAddr && reflect.PointerTo(t).Implements(marshalerType) {
 		return newCondAddrEncoder(addrMarshalerEncoder, newTypeEncoder(t, false))
 	}
@@ -735,8 +776,8 @@ func interfaceEncoder(e *encodeState, v reflect.Value, opts encOpts) {
 		e.WriteString("null")
 		return
 	}
-	if opts.isDiscriminatorSet() {
-		discriminatorInterfaceEncode(e, v, opts)
+	if do, ok := opts.discriminatorFor(v.Type()); ok {
+		discriminatorInterfaceEncode(e, v, opts, do)
 		return
 	}
 	e.reflectValue(v.Elem(), opts)
@@ -757,7 +798,7 @@ type structFields struct {
 
 func (se structEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
 	next := byte('{')
-	if opts.isDiscriminatorSet() {
+	if e.isDiscriminatorObject(opts) {
 		next = discriminatorStructEncode(e, v, opts)
 	}
 FieldLoop:
@@ -787,6 +828,11 @@ FieldLoop:
 			e.WriteString(f.nameNonEsc)
 		}
 		opts.quoted = f.quoted
+		opts.discriminatorField = f.discriminator
+		if f.discriminator.untyped {
+			f.encoder(e, fv, opts.withoutDiscriminator())
+			continue
+		}
 
 		f.encoder(e, fv, opts)
 	}
@@ -823,8 +869,10 @@ func (me mapEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
 	}
 	e.WriteByte('{')
 
-	if opts.isDiscriminatorSet() {
-		discriminatorMapEncode(e, v, opts)
+	var typeFieldName, valueFieldName string
+	if e.isDiscriminatorObject(opts) {
+		typeFieldName, valueFieldName = discriminatorMapEncode(e, v, opts)
+		opts.discriminatorField = fieldDiscriminator{}
 	}
 
 	// Extract and sort the keys.
@@ -836,6 +884,10 @@ func (me mapEncoder) encode(e *encodeState, v reflect.Value, opts encOpts) {
 		if err := sv[i].resolve(); err != nil {
 			e.error(fmt.Errorf("json: encoding error for type %q: %q", v.Type().String(), err.Error()))
 		}
+		if typeFieldName != "" && isDiscriminatorKey(sv[i].ks, typeFieldName) ||
+			valueFieldName != "" && isDiscriminatorKey(sv[i].ks, valueFieldName) {
+			sv[i].ks = discriminatorKeyPrefix + sv[i].ks
+		}
 	}
 	sort.Slice(sv, func(i, j int) bool { return sv[i].ks < sv[j].ks })
 
@@ -928,7 +980,7 @@ func newSliceEncoder(t reflect.Type) encoderFunc {
 	// Byte slices get special treatment; arrays don't.
 	if t.Elem().Kind() == reflect.Uint8 {
 		p := reflect.PointerTo(t.Elem())
-		if !p.Implements(marshalerType) && !p.Implements(textMarshalerType) {
+		if !p.Implements(marshalerType) && !p.Implements(optionsMarshalerType) && !p.Implements(textMarshalerType) {
 			return encodeByteSlice
 		}
 	}
@@ -1220,6 +1272,8 @@ type field struct {
 	omitEmpty bool
 	quoted    bool
 
+	discriminator fieldDiscriminator
+
 	encoder encoderFunc
 }
 
@@ -1334,6 +1388,8 @@ func typeFields(t reflect.Type) structFields {
 						typ:       ft,
 						omitEmpty: opts.Contains("omitempty"),
 						quoted:    quoted,
+
+						discriminator: parseFieldDiscriminator(opts),
 					}
 					field.nameBytes = []byte(field.name)
 					field.equalFold = foldFunc(field.nameBytes)
@@ -0,0 +1,132 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import "reflect"
+
+// MarshalerWithOptions is the interface implemented by types that can
+// marshal themselves into valid JSON using the options of the Encoder,
+// Codec, or Marshal call that is encoding them. It is used instead of
+// Marshaler when a type implements both.
+//
+// The options may be used to create a Codec for nested calls to Marshal,
+// so the values stored in interfaces below the type are encoded with the
+// same discriminator settings as the rest of the JSON value:
+//
+//	func (x T) MarshalJSONWithOptions(opts json.CodecOptions) ([]byte, error) {
+//		type alias T
+//		return json.NewCodec(opts).Marshal(alias(x))
+//	}
+//
+// The options do not include the indentation of the encoder since the
+// returned JSON is indented along with the rest of the value. The value
+// marshaled by the nested call is not treated as the root value, and the
+// type name of the alias is not encoded even when the encode mode includes
+// DiscriminatorEncodeTypeNameAllObjects.
+type MarshalerWithOptions interface {
+	MarshalJSONWithOptions(opts CodecOptions) ([]byte, error)
+}
+
+// UnmarshalerWithOptions is the interface implemented by types that can
+// unmarshal a JSON description of themselves using the options of the
+// Decoder, Codec, or Unmarshal call that is decoding them. It is used
+// instead of Unmarshaler when a type implements both. Please see
+// Unmarshaler for the requirements of the method.
+type UnmarshalerWithOptions interface {
+	UnmarshalJSONWithOptions(data []byte, opts CodecOptions) error
+}
+
+var optionsMarshalerType = reflect.TypeOf((*MarshalerWithOptions)(nil)).Elem()
+
+// codecOptions returns the options used by the encoder, without the
+// options of the struct field being encoded.
+func (opts encOpts) codecOptions() CodecOptions {
+	return CodecOptions{
+		TypeFieldName:     opts.discriminatorTypeFieldName,
+		ValueFieldName:    opts.discriminatorValueFieldName,
+		EncodeMode:        opts.discriminatorEncodeMode,
+		TypeRegistry:      opts.discriminatorTypeRegistry,
+		TypeNameFn:        opts.discriminatorTypeNameFn,
+		Layout:            opts.discriminatorLayout,
+		DisableHTMLEscape: !opts.escapeHTML,
+		nested:            true,
+	}
+}
+
+// codecOptions returns the options used by the decoder.
+func (d *decodeState) codecOptions() CodecOptions {
+	return CodecOptions{
+		TypeFieldName:            d.discriminatorTypeFieldName,
+		ValueFieldName:           d.discriminatorValueFieldName,
+		TypeFn:                   d.discriminatorToTypeFn,
+		TypeRegistry:             d.discriminatorTypeRegistry,
+		Layout:                   d.discriminatorLayout,
+		UnknownTypeFn:            d.discriminatorUnknownTypeFn,
+		UseNumber:                d.useNumber,
+		DisallowUnknownFields:    d.disallowUnknownFields,
+		DisallowTypeNameMismatch: d.disallowTypeNameMismatch,
+		DecodePolicy:             d.decodePolicy,
+	}
+}
+
+func optionsMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		e.WriteString("null")
+		return
+	}
+	m, ok := v.Interface().(MarshalerWithOptions)
+	if !ok {
+		e.WriteString("null")
+		return
+	}
+	e.marshalWithOptions(v.Type(), m, opts)
+}
+
+func addrOptionsMarshalerEncoder(e *encodeState, v reflect.Value, opts encOpts) {
+	va := v.Addr()
+	if va.IsNil() {
+		e.WriteString("null")
+		return
+	}
+	e.marshalWithOptions(v.Type(), va.Interface().(MarshalerWithOptions), opts)
+}
+
+func (e *encodeState) marshalWithOptions(t reflect.Type, m MarshalerWithOptions, opts encOpts) {
+	b, err := m.MarshalJSONWithOptions(opts.codecOptions())
+	if err == nil {
+		// copy JSON into buffer, checking validity.
+		err = compact(&e.Buffer, b, opts.escapeHTML)
+	}
+	if err != nil {
+		e.error(&MarshalerError{t, err, "MarshalJSONWithOptions"})
+	}
+}
+
+// An optionsUnmarshaler is returned by indirect for a value that implements
+// UnmarshalerWithOptions. Its UnmarshalJSON method uses the default options,
+// so the decodeState calls UnmarshalJSONWithOptions with its own options
+// instead. Please see decodeState.unmarshalJSON.
+type optionsUnmarshaler struct {
+	UnmarshalerWithOptions
+}
+
+func (u optionsUnmarshaler) UnmarshalJSON(data []byte) error {
+	return u.UnmarshalJSONWithOptions(data, CodecOptions{})
+}
+
+// unmarshalJSON calls the Unmarshaler returned by indirect with data, the
+// JSON value that begins at the offset start of d.data.
+func (d *decodeState) unmarshalJSON(u Unmarshaler, data []byte, start int) error {
+	var err error
+	if ou, ok := u.(optionsUnmarshaler); ok {
+		err = ou.UnmarshalJSONWithOptions(data, d.codecOptions())
+	} else {
+		err = u.UnmarshalJSON(data)
+	}
+	if err != nil {
+		d.offsetUnmarshalerError(err, data, start)
+	}
+	return err
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A DecodePolicy limits the resources used to decode untrusted JSON input
+// and the Go types that may be constructed from the type names in it.
+// The zero value of each field does not limit anything.
+type DecodePolicy struct {
+	// MaxArrayLen is the maximum number of elements of an array type
+	// constructed from a type name, including the elements of the arrays
+	// nested in it, ex. "[4][2]int" has 8 elements.
+	MaxArrayLen int
+
+	// MaxTypeSize is the maximum size in bytes, as reported by
+	// reflect.Type.Size, of an array or struct type constructed from a type
+	// name, ex. "[1024]int64" has a size of 8192 bytes.
+	MaxTypeSize int64
+
+	// DisallowCompositeTypeNames causes an error when an array, map,
+	// pointer, slice, or struct type would be constructed from a type name,
+	// ex. "[]int" or "*Dog". Only the types that are built-in, registered, or
+	// returned by a DiscriminatorToTypeFunc may be decoded.
+	DisallowCompositeTypeNames bool
+
+	// MaxDepth is the maximum nesting depth of JSON arrays and objects.
+	MaxDepth int
+
+	// MaxInputBytes is the maximum number of bytes of JSON input. A Decoder
+	// counts all of the bytes read from its input stream.
+	MaxInputBytes int64
+
+	// MaxDiscriminatedValues is the maximum number of discriminated JSON
+	// values decoded into interfaces as part of a single JSON value.
+	MaxDiscriminatedValues int
+}
+
+// A PolicyError describes JSON input that exceeds a limit of a
+// DecodePolicy.
+type PolicyError struct {
+	Limit    string // name of the DecodePolicy field, ex. "MaxDepth"
+	TypeName string // type name that exceeds the limit, if any
+	Offset   int64  // error occurred after reading Offset bytes, or -1 if not known
+
+	msg string
+}
+
+func (e *PolicyError) Error() string {
+	return e.msg
+}
+
+// newPolicyError returns a new PolicyError for the provided limit. The
+// error's message is formatted from format and args.
+func newPolicyError(limit string, off int64, format string, args ...interface{}) *PolicyError {
+	return &PolicyError{
+		Limit:  limit,
+		Offset: off,
+		msg:    "json: " + fmt.Sprintf(format, args...),
+	}
+}
+
+// checkArrayLen returns an error if an array type of the length n with the
+// element type et may not be constructed from the type name tn. The
+// elements of the arrays nested in et are counted as well.
+func (p DecodePolicy) checkArrayLen(tn string, n int, et reflect.Type) error {
+	if p.MaxArrayLen <= 0 {
+		return nil
+	}
+	count := uint64(n)
+	for ; et.Kind() == reflect.Array && count <= uint64(p.MaxArrayLen); et = et.Elem() {
+		count *= uint64(et.Len())
+	}
+	if count > uint64(p.MaxArrayLen) {
+		e := newPolicyError("MaxArrayLen", -1,
+			"array length of type %s exceeds the maximum of %d", tn, p.MaxArrayLen)
+		e.TypeName = tn
+		return e
+	}
+	return nil
+}
+
+// checkTypeSize returns an error if a type of the size n may not be
+// constructed from the type name tn.
+func (p DecodePolicy) checkTypeSize(tn string, n uint64) error {
+	if p.MaxTypeSize > 0 && n > uint64(p.MaxTypeSize) {
+		e := newPolicyError("MaxTypeSize", -1,
+			"size of type %s exceeds the maximum of %d bytes", tn, p.MaxTypeSize)
+		e.TypeName = tn
+		return e
+	}
+	return nil
+}
+
+// checkComposite returns an error if a composite type may not be
+// constructed from the type name tn.
+func (p DecodePolicy) checkComposite(tn string) error {
+	if p.DisallowCompositeTypeNames {
+		e := newPolicyError("DisallowCompositeTypeNames", -1,
+			"composite type %s is not allowed", tn)
+		e.TypeName = tn
+		return e
+	}
+	return nil
+}
+
+// checkValid is like the package-level checkValid but first checks that data
+// does not exceed the policy's limits.
+func (p DecodePolicy) checkValid(data []byte, scan *scanner) error {
+	if p.MaxInputBytes > 0 && int64(len(data)) > p.MaxInputBytes {
+		return newPolicyError("MaxInputBytes", p.MaxInputBytes,
+			"input exceeds the maximum of %d bytes", p.MaxInputBytes)
+	}
+	scan.maxDepth = p.MaxDepth
+	return checkValid(data, scan)
+}
+
+// limitInputBytes discards the data read by the decoder beyond the policy's
+// limit, returning an error if there was any. The values that end before
+// the limit may still be decoded, and the error is returned by every
+// subsequent attempt to read more data.
+func (dec *Decoder) limitInputBytes() error {
+	limit := dec.d.decodePolicy.MaxInputBytes
+	if limit > 0 && dec.scanned+int64(len(dec.buf)) > limit {
+		dec.buf = dec.buf[:limit-dec.scanned]
+		dec.limitErr = newPolicyError("MaxInputBytes", limit,
+			"input exceeds the maximum of %d bytes", limit)
+		return dec.limitErr
+	}
+	return nil
+}
+
+// checkTokenDepth returns an error if a JSON array or object that begins
+// with the next byte exceeds the policy's maximum depth.
+func (dec *Decoder) checkTokenDepth() error {
+	limit := dec.d.decodePolicy.MaxDepth
+	if limit > 0 && len(dec.tokenStack) >= limit {
+		return newPolicyError("MaxDepth", dec.InputOffset(),
+			"exceeded max depth of %d", limit)
+	}
+	return nil
+}
+
+// discriminatorCount counts a discriminated JSON value, returning an error
+// if the number of discriminated values exceeds the policy's limit.
+func (d *decodeState) discriminatorCount() error {
+	d.discriminatedValues++
+	if limit := d.decodePolicy.MaxDiscriminatedValues; limit > 0 && d.discriminatedValues > limit {
+		pe := newPolicyError("MaxDiscriminatedValues", int64(d.readIndex()),
+			"exceeded the maximum of %d discriminated values", limit)
+		de := newDiscriminatorError(reasonPolicyViolation, "", -1, "%s", pe)
+		de.Err = pe
+		return de
+	}
+	return nil
+}
+
+// newTypeNameError returns the DiscriminatorError for the error err that
+// occurred while parsing the type name tn at the offset off.
+func newTypeNameError(tn string, off int, err error) *DiscriminatorError {
+	reason := reasonUnknownType
+	if _, ok := err.(*PolicyError); ok {
+		reason = reasonPolicyViolation
+	}
+	de := newDiscriminatorError(reason, tn, off, "%s", err)
+	de.Err = err
+	return de
+}
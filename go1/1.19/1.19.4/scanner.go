@@ -45,8 +45,11 @@ func checkValid(data []byte, scan *scanner) error {
 // A SyntaxError is a description of a JSON syntax error.
 // Unmarshal will return a SyntaxError if the JSON can't be parsed.
 type SyntaxError struct {
-	msg    string // description of error
-	Offset int64  // error occurred after reading Offset bytes
+	msg     string // description of error
+	Offset  int64  // error occurred after reading Offset bytes
+	Line    int    // line on which the error occurred, starting at 1
+	Column  int    // column at which the error occurred, in bytes, starting at 1
+	Excerpt string // line on which the error occurred, with a caret below Column
 }
 
 func (e *SyntaxError) Error() string { return e.msg }
@@ -82,6 +85,11 @@ type scanner struct {
 	// total bytes consumed, updated by decoder.Decode (and deliberately
 	// not set to zero by scan.reset)
 	bytes int64
+
+	// Maximum nesting depth of a DecodePolicy, if any, and the depth of
+	// the arrays and objects in which the value is nested.
+	maxDepth  int
+	baseDepth int
 }
 
 var scannerPool = sync.Pool{
@@ -168,7 +176,7 @@ func (s *scanner) eof() int {
 		return scanEnd
 	}
 	if s.err == nil {
-		s.err = &SyntaxError{"unexpected end of JSON input", s.bytes}
+		s.err = &SyntaxError{msg: "unexpected end of JSON input", Offset: s.bytes}
 	}
 	return scanError
 }
@@ -177,10 +185,15 @@ func (s *scanner) eof() int {
 // an error state is returned if maxNestingDepth was exceeded, otherwise successState is returned.
 func (s *scanner) pushParseState(c byte, newParseState int, successState int) int {
 	s.parseState = append(s.parseState, newParseState)
-	if len(s.parseState) <= maxNestingDepth {
-		return successState
+	if len(s.parseState) > maxNestingDepth {
+		return s.error(c, "exceeded max depth")
+	}
+	if s.maxDepth > 0 && s.baseDepth+len(s.parseState) > s.maxDepth {
+		s.step = stateError
+		s.err = newPolicyError("MaxDepth", s.bytes, "exceeded max depth of %d", s.maxDepth)
+		return scanError
 	}
-	return s.error(c, "exceeded max depth")
+	return successState
 }
 
 // popParseState pops a parse state (already obtained) off the stack
@@ -590,7 +603,7 @@ func stateError(s *scanner, c byte) int {
 // error records an error and switches to the error state.
 func (s *scanner) error(c byte, context string) int {
 	s.step = stateError
-	s.err = &SyntaxError{"invalid character " + quoteChar(c) + " " + context, s.bytes}
+	s.err = &SyntaxError{msg: "invalid character " + quoteChar(c) + " " + context, Offset: s.bytes}
 	return scanError
 }
 
@@ -389,18 +389,18 @@ var tokenStreamCases = []tokenStreamCase{
 	{json: ` [{"a": 1} {"a": 2}] `, expTokens: []any{
 		Delim('['),
 		decodeThis{map[string]any{"a": float64(1)}},
-		decodeThis{&SyntaxError{"expected comma after array element", 11}},
+		decodeThis{&SyntaxError{msg: "expected comma after array element", Offset: 11, Line: 1, Column: 12, Excerpt: ` [{"a": 1} {"a": 2}] ` + "\n" + strings.Repeat(" ", 11) + "^"}},
 	}},
 	{json: `{ "` + strings.Repeat("a", 513) + `" 1 }`, expTokens: []any{
 		Delim('{'), strings.Repeat("a", 513),
-		decodeThis{&SyntaxError{"expected colon after object key", 518}},
+		decodeThis{&SyntaxError{msg: "expected colon after object key", Offset: 518, Line: 1, Column: 519, Excerpt: "..." + strings.Repeat("a", 67) + `" 1 }` + "\n" + strings.Repeat(" ", 72) + "^"}},
 	}},
 	{json: `{ "\a" }`, expTokens: []any{
 		Delim('{'),
-		&SyntaxError{"invalid character 'a' in string escape code", 3},
+		&SyntaxError{msg: "invalid character 'a' in string escape code", Offset: 3, Line: 1, Column: 5, Excerpt: `{ "\a" }` + "\n    ^"},
 	}},
 	{json: ` \a`, expTokens: []any{
-		&SyntaxError{"invalid character '\\\\' looking for beginning of value", 1},
+		&SyntaxError{msg: "invalid character '\\\\' looking for beginning of value", Offset: 1, Line: 1, Column: 2, Excerpt: ` \a` + "\n ^"},
 	}},
 }
 
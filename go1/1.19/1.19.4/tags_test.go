@@ -26,3 +26,21 @@ func TestTagParsing(t *testing.T) {
 		}
 	}
 }
+
+func TestTagOptionValue(t *testing.T) {
+	_, opts := parseTag("field,typed,discriminator=kind,foo=")
+	for _, tt := range []struct {
+		opt   string
+		want  string
+		found bool
+	}{
+		{"discriminator", "kind", true},
+		{"foo", "", true},
+		{"typed", "", false},
+		{"bar", "", false},
+	} {
+		if v, ok := opts.Value(tt.opt); v != tt.want || ok != tt.found {
+			t.Errorf("Value(%q) = %q, %v", tt.opt, v, ok)
+		}
+	}
+}
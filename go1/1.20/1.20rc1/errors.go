@@ -0,0 +1,288 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A DiscriminatorError describes a discriminated JSON value that could not
+// be decoded into an interface.
+type DiscriminatorError struct {
+	TypeName string       // type name read from the JSON value, if any
+	Reason   string       // description of the error, ex. "missing discriminator"
+	Offset   int64        // error occurred after reading Offset bytes
+	Path     string       // JSON Pointer to the JSON value, ex. "/pets/0"
+	Type     reflect.Type // type of the interface or value into which the value is decoded
+	Err      error        // underlying error, if any
+	Line     int          // line on which the JSON value begins, starting at 1
+	Column   int          // column at which the JSON value begins, in bytes, starting at 1
+	Excerpt  string       // line on which the JSON value begins, with a caret below Column
+
+	msg string
+}
+
+func (e *DiscriminatorError) Error() string {
+	if e.msg != "" {
+		return e.msg
+	}
+	return "json: " + e.Reason
+}
+
+func (e *DiscriminatorError) Unwrap() error {
+	return e.Err
+}
+
+// The reasons a discriminated JSON value cannot be decoded.
+const (
+	reasonMissingType     = "missing discriminator"
+	reasonTypeNotString   = "discriminator type is not string"
+	reasonEmptyType       = "discriminator type is empty"
+	reasonUnknownType     = "unknown discriminator type"
+	reasonTypeNotAllowed  = "discriminator type is not allowed"
+	reasonUnsupportedType = "unsupported discriminator type"
+	reasonUnsupportedKind = "unsupported discriminator kind"
+	reasonMissingValue    = "missing discriminator value"
+	reasonTooManyFields   = "externally discriminated object has more than one field"
+	reasonTooManyElements = "discriminated array has more than two elements"
+	reasonTypeMismatch    = "discriminator type does not match"
+	reasonPolicyViolation = "decode policy violated"
+)
+
+// newDiscriminatorError returns a new DiscriminatorError with the provided
+// reason and type name. The offset is -1 if it is not known. The error's
+// message is formatted from format and args.
+func newDiscriminatorError(
+	reason, tn string, off int, format string, args ...interface{}) *DiscriminatorError {
+
+	return &DiscriminatorError{
+		TypeName: tn,
+		Reason:   reason,
+		Offset:   int64(off),
+		msg:      fmt.Sprintf(format, args...),
+	}
+}
+
+// discriminatorError adds the offset, path, and type of the discriminated
+// JSON value that begins at the offset start and is decoded into a value of
+// type t to err if it is a DiscriminatorError without them, ex. one that was
+// not returned while decoding a nested value.
+func (d *decodeState) discriminatorError(err error, start int, t reflect.Type) error {
+	de, ok := err.(*DiscriminatorError)
+	if !ok || de.Type != nil {
+		return err
+	}
+	if de.Offset < 0 {
+		de.Offset = int64(start)
+	}
+	de.Path = jsonPointer(d.data, start)
+	de.Type = t
+	return de
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// jsonPointer returns the JSON Pointer (RFC 6901) to the JSON value that
+// begins at the offset off in the valid JSON data. The data is scanned
+// only when an error is reported, so the decoder does not need to track
+// the path to every value it decodes.
+func jsonPointer(data []byte, off int) string {
+	type segment struct {
+		key   string
+		index int // -1 for objects
+	}
+	var (
+		scan     scanner
+		segments []segment
+		keyStart = -1
+	)
+	scan.reset()
+	for i := 0; i < off && i < len(data); i++ {
+		switch scan.step(&scan, data[i]) {
+		case scanBeginObject:
+			segments = append(segments, segment{index: -1})
+		case scanBeginArray:
+			segments = append(segments, segment{})
+		case scanBeginLiteral:
+			if n := len(scan.parseState); n > 0 && scan.parseState[n-1] == parseObjectKey {
+				keyStart = i
+			}
+		case scanObjectKey:
+			item := strings.TrimRight(string(data[keyStart:i]), " \t\r\n")
+			key, ok := unquote([]byte(item))
+			if !ok {
+				panic(phasePanicMsg)
+			}
+			segments[len(segments)-1].key = key
+		case scanArrayValue:
+			segments[len(segments)-1].index++
+		case scanEndObject, scanEndArray:
+			segments = segments[:len(segments)-1]
+		}
+	}
+
+	var b strings.Builder
+	for _, s := range segments {
+		b.WriteByte('/')
+		if s.index >= 0 {
+			b.WriteString(strconv.Itoa(s.index))
+			continue
+		}
+		b.WriteString(jsonPointerEscaper.Replace(s.key))
+	}
+	return b.String()
+}
+
+// excerptLen is the maximum length of the line in an error's excerpt.
+const excerptLen = 72
+
+// setErrorPosition sets the line, column, and excerpt of err if it is, or
+// wraps, a SyntaxError, UnmarshalTypeError, or DiscriminatorError without
+// them. The offset of the error in data is its Offset plus delta, and the
+// first byte of data is at the provided line and column. The position is computed
+// only when an error is returned, so the decoder does not need to track
+// lines and columns while decoding.
+func setErrorPosition(err error, data []byte, delta int64, line, column int) error {
+	var se *SyntaxError
+	if errors.As(err, &se) && se.Line == 0 {
+		se.Line, se.Column, se.Excerpt = position(data, se.Offset+delta-1, line, column)
+	}
+	var ute *UnmarshalTypeError
+	if errors.As(err, &ute) && ute.Line == 0 {
+		ute.Line, ute.Column, ute.Excerpt = position(data, ute.Offset+delta-1, line, column)
+	}
+	// The offset of a discriminated JSON value is where it begins rather
+	// than the number of bytes read before the error occurred.
+	var de *DiscriminatorError
+	if errors.As(err, &de) && de.Line == 0 && de.Offset >= 0 {
+		de.Line, de.Column, de.Excerpt = position(data, de.Offset+delta, line, column)
+	}
+	return err
+}
+
+// offsetUnmarshalerError makes the offsets of the SyntaxError,
+// UnmarshalTypeError, and DiscriminatorError in err, which count from the
+// start of the data given to an Unmarshaler, offsets into d.data. Their
+// positions, if any, are cleared so setErrorPosition computes them again.
+// If data is not a part of d.data, ex. if the type field was removed from
+// it, the errors are positioned at the start of the value instead.
+func (d *decodeState) offsetUnmarshalerError(err error, data []byte, start int) {
+	off, ok := d.dataOffset(data)
+	var se *SyntaxError
+	if errors.As(err, &se) {
+		if ok {
+			se.Offset += int64(off)
+		} else {
+			se.Offset = int64(start) + 1
+		}
+		se.Line, se.Column, se.Excerpt = 0, 0, ""
+	}
+	var ute *UnmarshalTypeError
+	if errors.As(err, &ute) {
+		if ok {
+			ute.Offset += int64(off)
+		} else {
+			ute.Offset = int64(start) + 1
+		}
+		ute.Line, ute.Column, ute.Excerpt = 0, 0, ""
+	}
+	var de *DiscriminatorError
+	if errors.As(err, &de) && de.Offset >= 0 {
+		if ok {
+			de.Offset += int64(off)
+		} else {
+			de.Offset = int64(start)
+		}
+		de.Line, de.Column, de.Excerpt = 0, 0, ""
+	}
+}
+
+// dataOffset returns the offset of data in d.data. A false value is
+// returned if data is not a part of d.data.
+func (d *decodeState) dataOffset(data []byte) (int, bool) {
+	off := cap(d.data) - cap(data)
+	if len(data) == 0 || off < 0 || off >= len(d.data) || &d.data[off] != &data[0] {
+		return 0, false
+	}
+	return off, true
+}
+
+// position returns the line, column, and excerpt of the byte at the offset
+// off in data, where the first byte of data is at the provided line and
+// column. The excerpt is the line containing the byte, shortened to at most
+// excerptLen bytes around it, followed by a line with a caret below it.
+func position(data []byte, off int64, line, column int) (int, int, string) {
+	i := int(off)
+	if i > len(data) {
+		i = len(data)
+	}
+	if i < 0 {
+		i = 0
+	}
+
+	// Find the line containing the byte.
+	start := bytes.LastIndexByte(data[:i], '\n') + 1
+	if start > 0 {
+		line += bytes.Count(data[:start], []byte{'\n'})
+		column = 1
+	}
+	shortened := column > 1
+	column += i - start
+	end := bytes.IndexByte(data[start:], '\n')
+	if end < 0 {
+		end = len(data)
+	} else {
+		end += start
+	}
+	if end > start && data[end-1] == '\r' {
+		end--
+	}
+
+	// Shorten a long line around the byte without splitting runes.
+	from, to := start, end
+	if to-from > excerptLen {
+		if from = i - excerptLen/2; from < start {
+			from = start
+		}
+		if to = from + excerptLen; to > end {
+			to, from = end, end-excerptLen
+		}
+		for from < i && !utf8.RuneStart(data[from]) {
+			from++
+		}
+		for to < end && !utf8.RuneStart(data[to]) {
+			to++
+		}
+		shortened = shortened || from > start
+	}
+
+	var b strings.Builder
+	if shortened {
+		b.WriteString("...")
+	}
+	b.Write(data[from:to])
+	if to < end {
+		b.WriteString("...")
+	}
+	b.WriteByte('\n')
+	if shortened {
+		b.WriteString("   ")
+	}
+	for _, r := range string(data[from:i]) {
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteByte('^')
+	return line, column, b.String()
+}
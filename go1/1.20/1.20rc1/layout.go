@@ -0,0 +1,185 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import "reflect"
+
+// DiscriminatorLayout describes where the type name is encoded relative to
+// a value stored in an interface.
+type DiscriminatorLayout uint8
+
+const (
+	// DiscriminatorLayoutInline is the default layout. The type name is
+	// encoded as a field of map and struct values, ex.
+	// {"type":"Dog","name":"Rex"}, and all other values are encoded inside
+	// an outer JSON object, ex. {"type":"int","value":1}.
+	DiscriminatorLayoutInline DiscriminatorLayout = iota
+
+	// DiscriminatorLayoutExternal encodes values inside an outer JSON object
+	// with a single field named after the type, ex. {"Dog":{"name":"Rex"}}.
+	// The type and value field names are not used.
+	DiscriminatorLayoutExternal
+
+	// DiscriminatorLayoutAdjacent encodes all values, including map and
+	// struct values, inside an outer JSON object with a field that specifies
+	// the type name and a field that specifies the value, ex.
+	// {"type":"Dog","value":{"name":"Rex"}}.
+	DiscriminatorLayoutAdjacent
+
+	// DiscriminatorLayoutTuple encodes values as a JSON array with two
+	// elements, the type name and the value, ex. ["Dog",{"name":"Rex"}].
+	// The type and value field names are not used.
+	DiscriminatorLayoutTuple
+)
+
+// isSet reports whether the discriminator is set for the layout and the
+// provided type and value field names.
+func (l DiscriminatorLayout) isSet(typeFieldName, valueFieldName string) bool {
+	switch l {
+	case DiscriminatorLayoutExternal, DiscriminatorLayoutTuple:
+		return true
+	default:
+		return typeFieldName != "" && valueFieldName != ""
+	}
+}
+
+// discriminatorExternalDecode decodes an externally tagged JSON object into
+// v, which has the type t. The first byte ('{') of the object has been read
+// already.
+func (d *decodeState) discriminatorExternalDecode(
+	t reflect.Type, v reflect.Value, do discriminatorOpts) error {
+
+	begin := d.readIndex()
+
+	// Read opening " of the type name or closing }.
+	d.scanWhile(scanSkipSpace)
+	if d.opcode == scanEndObject {
+		return newDiscriminatorError(
+			reasonMissingType, "", begin, "json: missing discriminator")
+	}
+	if d.opcode != scanBeginLiteral {
+		panic(phasePanicMsg)
+	}
+
+	// Read the type name.
+	start := d.readIndex()
+	d.rescanLiteral()
+	item := d.data[start:d.readIndex()]
+	tn, ok := unquote(item)
+	if !ok {
+		panic(phasePanicMsg)
+	}
+
+	// Read : before value.
+	if d.opcode == scanSkipSpace {
+		d.scanWhile(scanSkipSpace)
+	}
+	if d.opcode != scanObjectKey {
+		panic(phasePanicMsg)
+	}
+	d.scanWhile(scanSkipSpace)
+
+	if err := d.discriminatorDecodeValue(t, v, tn, begin, start, do); err != nil {
+		return err
+	}
+
+	// Next token must be }.
+	if d.opcode == scanSkipSpace {
+		d.scanWhile(scanSkipSpace)
+	}
+	if d.opcode != scanEndObject {
+		return newDiscriminatorError(
+			reasonTooManyFields, tn, start,
+			"json: externally discriminated object at offset %d has more than one field",
+			start)
+	}
+	return nil
+}
+
+// discriminatorTupleDecode decodes a JSON array with the type name and
+// value into v, which has the type t. The first byte ('[') of the array has
+// been read already.
+func (d *decodeState) discriminatorTupleDecode(
+	t reflect.Type, v reflect.Value, do discriminatorOpts) error {
+
+	begin := d.readIndex()
+
+	// Read the type name.
+	d.scanWhile(scanSkipSpace)
+	if d.opcode == scanEndArray {
+		return newDiscriminatorError(
+			reasonMissingType, "", begin, "json: missing discriminator")
+	}
+	start := d.readIndex()
+	if d.opcode != scanBeginLiteral || d.data[start] != '"' {
+		return newDiscriminatorError(
+			reasonTypeNotString, "", start,
+			"json: discriminator type at offset %d is not string", start)
+	}
+	d.rescanLiteral()
+	tn, ok := unquote(d.data[start:d.readIndex()])
+	if !ok {
+		panic(phasePanicMsg)
+	}
+
+	// Read , before value.
+	if d.opcode == scanSkipSpace {
+		d.scanWhile(scanSkipSpace)
+	}
+	if d.opcode != scanArrayValue {
+		return newDiscriminatorError(
+			reasonMissingValue, tn, start,
+			"json: missing discriminator value at offset %d", start)
+	}
+	d.scanWhile(scanSkipSpace)
+
+	if err := d.discriminatorDecodeValue(t, v, tn, begin, start, do); err != nil {
+		return err
+	}
+
+	// Next token must be ].
+	if d.opcode == scanSkipSpace {
+		d.scanWhile(scanSkipSpace)
+	}
+	if d.opcode != scanEndArray {
+		return newDiscriminatorError(
+			reasonTooManyElements, tn, start,
+			"json: discriminated array at offset %d has more than two elements",
+			start)
+	}
+	return nil
+}
+
+// discriminatorDecodeValue decodes the next JSON value as the type named
+// tn and stores the result in v, which has the type t. The discriminated
+// JSON value begins at the offset begin, and the type name was read at the
+// offset off.
+func (d *decodeState) discriminatorDecodeValue(
+	t reflect.Type, v reflect.Value, tn string, begin, off int, do discriminatorOpts) error {
+
+	if tn == "" {
+		return newDiscriminatorError(
+			reasonEmptyType, "", off,
+			"json: discriminator type at offset %d is empty", off)
+	}
+	dt, err := d.discriminatorParseType(tn, do)
+	if err != nil {
+		// Skip over the value.
+		d.value(reflect.Value{})
+		dv, err := d.discriminatorUnknownValue(tn, begin, do, err)
+		if err != nil {
+			return err
+		}
+		return discriminatorSetValue(t, v, dv)
+	}
+	dv, err := discriminatorNewValue(dt)
+	if err != nil {
+		return err
+	}
+	if err := d.value(dv); err != nil {
+		return err
+	}
+	return discriminatorSetValue(t, v, dv)
+}
@@ -0,0 +1,316 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"errors"
+	"io"
+	"reflect"
+)
+
+// A TypedObjectStart is returned by Decoder.Token in place of the Delim
+// that begins a discriminated JSON value when UseTypedObjectStart has been
+// called. The value is not consumed, so the next call to Token returns the
+// Delim, and a call to Decode decodes the entire value.
+type TypedObjectStart struct {
+	// TypeName is the type name read from the JSON value.
+	TypeName string
+
+	// Type is the Go type named by TypeName. It is nil if the type name
+	// cannot be resolved and the decoder has an UnknownTypeFunc.
+	Type reflect.Type
+}
+
+// UseTypedObjectStart causes Token to return a TypedObjectStart before
+// the Delim that begins a JSON object, or a JSON array when using
+// DiscriminatorLayoutTuple, that has a type name. An error is returned
+// instead if the type name cannot be resolved to a Go type.
+func (dec *Decoder) UseTypedObjectStart() { dec.typedObjectStarts = true }
+
+// PeekDiscriminator returns the type name of the next JSON value in the
+// input stream and the Go type it names, without consuming the value.
+// An empty type name and a nil type are returned if the value does not
+// have a type name, ex. if it is not a JSON object or it does not have a
+// type field.
+//
+// The type name and type are read the same way as when the value is decoded
+// into an empty interface. If the type name cannot be resolved to a Go type
+// then the type name is returned with a DiscriminatorError, unless the
+// decoder has an UnknownTypeFunc, in which case the type is nil.
+//
+// Only the part of the value that precedes the end of its type field is read
+// into the decoder's buffer, so a large value is not buffered just to read
+// its type name. When using DiscriminatorLayoutInline the value may be
+// decoded into the returned type with Decode. Values encoded
+// with other layouts must be decoded into an interface.
+func (dec *Decoder) PeekDiscriminator() (string, reflect.Type, error) {
+	if dec.err != nil {
+		return "", nil, dec.err
+	}
+
+	if err := dec.tokenPrepareForDecode(); err != nil {
+		return "", nil, dec.errorAt(err, dec.scanp)
+	}
+
+	if !dec.tokenValueAllowed() {
+		return "", nil, dec.errorAt(&SyntaxError{msg: "not at beginning of value", Offset: dec.InputOffset()}, dec.scanp)
+	}
+
+	return dec.peekDiscriminator()
+}
+
+// peekDiscriminator reads the next JSON value into the decoder's buffer up to
+// the end of its type field and returns its type name and type.
+func (dec *Decoder) peekDiscriminator() (string, reflect.Type, error) {
+	d := &dec.d
+	if !d.isDiscriminatorSet() {
+		return "", nil, nil
+	}
+	do, _ := d.discriminatorFor(interfaceType)
+
+	// The value is scanned again when it is decoded, so the number of bytes
+	// read by the scanner is restored.
+	nbytes := dec.scan.bytes
+	n, err := dec.readTypeName(do)
+	if err != nil {
+		return "", nil, err
+	}
+	dec.scan.bytes = nbytes
+
+	d.init(dec.buf[dec.scanp : dec.scanp+n])
+	d.scan.reset()
+	d.scanWhile(scanSkipSpace)
+	start := d.readIndex()
+
+	tn, err := d.discriminatorPeekTypeName(do)
+	if err == nil && tn != "" {
+		var t reflect.Type
+		if t, err = d.discriminatorParseType(tn, do); err == nil {
+			return tn, t, nil
+		}
+		var de *DiscriminatorError
+		if errors.As(err, &de) && de.Reason == reasonUnknownType &&
+			d.discriminatorUnknownTypeFn != nil {
+			return tn, nil, nil
+		}
+	}
+	if err != nil {
+		err = d.discriminatorError(err, start, interfaceType)
+		return tn, nil, dec.errorPosition(err, dec.InputOffset())
+	}
+	return "", nil, nil
+}
+
+// readTypeName is like readValue but stops reading the JSON value as soon as
+// its type name has been read, or it is known that the value does not have
+// one. It returns the length of the data read, which is enough for
+// discriminatorPeekTypeName to read the type name of the value.
+func (dec *Decoder) readTypeName(do discriminatorOpts) (int, error) {
+	dec.scan.reset()
+	dec.scan.baseDepth = len(dec.tokenStack)
+
+	begin := scanBeginObject
+	if do.layout == DiscriminatorLayoutTuple {
+		begin = scanBeginArray
+	}
+
+	var (
+		began  bool // the first byte of the value has been read
+		keyOff int  // offset of the current key from dec.scanp
+		isType bool // the current key is the type field
+	)
+
+	scanp := dec.scanp
+	var err error
+Input:
+	for scanp >= 0 {
+		for ; scanp < len(dec.buf); scanp++ {
+			c := dec.buf[scanp]
+			dec.scan.bytes++
+			op := dec.scan.step(&dec.scan, c)
+			switch op {
+			case scanSkipSpace, scanContinue:
+				continue
+			case scanError:
+				dec.err = dec.errorAt(dec.scan.err, scanp)
+				return 0, dec.err
+			}
+			if !began {
+				began = true
+				if op != begin {
+					// The value does not have a type name.
+					scanp++
+					break Input
+				}
+				continue
+			}
+
+			switch depth := len(dec.scan.parseState); {
+			case depth == 0:
+				// The end of the value.
+				scanp++
+				break Input
+			case depth > 1:
+				// Skip over the values nested in the value's elements.
+				continue
+			}
+
+			switch op {
+			case scanBeginLiteral:
+				if dec.scan.parseState[0] == parseObjectKey {
+					keyOff = scanp - dec.scanp
+				}
+			case scanObjectKey:
+				if do.layout == DiscriminatorLayoutExternal {
+					// The type name is the first key.
+					scanp++
+					break Input
+				}
+				key := dec.buf[dec.scanp+keyOff : scanp]
+				for isSpace(key[len(key)-1]) {
+					key = key[:len(key)-1]
+				}
+				tn, ok := unquote(key)
+				isType = ok && tn == do.typeFieldName
+			case scanObjectValue:
+				if isType {
+					scanp++
+					break Input
+				}
+			case scanArrayValue:
+				// The type name is the first element.
+				scanp++
+				break Input
+			}
+		}
+
+		// Did the last read have an error?
+		// Delayed until now to allow buffer scan.
+		if err != nil {
+			if err == io.EOF && nonSpace(dec.buf) {
+				err = io.ErrUnexpectedEOF
+			}
+			dec.err = err
+			return 0, err
+		}
+
+		n := scanp - dec.scanp
+		err = dec.refill()
+		scanp = dec.scanp + n
+	}
+	return scanp - dec.scanp, nil
+}
+
+// discriminatorPeekTypeName returns the type name of the JSON value, the
+// first byte of which has been read already, without decoding it. An empty
+// type name is returned if the value does not have a type name.
+func (d *decodeState) discriminatorPeekTypeName(do discriminatorOpts) (string, error) {
+	if do.layout == DiscriminatorLayoutTuple {
+		if d.opcode != scanBeginArray {
+			return "", nil
+		}
+
+		// Read the type name.
+		d.scanWhile(scanSkipSpace)
+		if d.opcode == scanEndArray {
+			return "", nil
+		}
+		start := d.readIndex()
+		if d.opcode != scanBeginLiteral || d.data[start] != '"' {
+			return "", newDiscriminatorError(
+				reasonTypeNotString, "", start,
+				"json: discriminator type at offset %d is not string", start)
+		}
+		d.rescanLiteral()
+		tn, ok := unquote(d.data[start:d.readIndex()])
+		if !ok {
+			panic(phasePanicMsg)
+		}
+		if tn == "" {
+			return "", newDiscriminatorError(
+				reasonEmptyType, "", start,
+				"json: discriminator type at offset %d is empty", start)
+		}
+		return tn, nil
+	}
+
+	if d.opcode != scanBeginObject {
+		return "", nil
+	}
+
+	for {
+		// Read opening " of string key or closing }.
+		d.scanWhile(scanSkipSpace)
+		if d.opcode == scanEndObject {
+			return "", nil
+		}
+		if d.opcode != scanBeginLiteral {
+			panic(phasePanicMsg)
+		}
+
+		// Read key.
+		start := d.readIndex()
+		d.rescanLiteral()
+		key, ok := unquote(d.data[start:d.readIndex()])
+		if !ok {
+			panic(phasePanicMsg)
+		}
+		if do.layout == DiscriminatorLayoutExternal {
+			// The type name is the only key of an externally
+			// discriminated object.
+			if key == "" {
+				return "", newDiscriminatorError(
+					reasonEmptyType, "", start,
+					"json: discriminator type at offset %d is empty", start)
+			}
+			return key, nil
+		}
+
+		// Read : before value.
+		if d.opcode == scanSkipSpace {
+			d.scanWhile(scanSkipSpace)
+		}
+		if d.opcode != scanObjectKey {
+			panic(phasePanicMsg)
+		}
+		d.scanWhile(scanSkipSpace)
+		valOff := d.readIndex()
+
+		if key == do.typeFieldName {
+			if d.opcode != scanBeginLiteral || d.data[valOff] != '"' {
+				return "", newDiscriminatorError(
+					reasonTypeNotString, "", valOff,
+					"json: discriminator type at offset %d is not string",
+					valOff)
+			}
+			d.rescanLiteral()
+			tn, ok := unquote(d.data[valOff:d.readIndex()])
+			if !ok {
+				panic(phasePanicMsg)
+			}
+			if tn == "" {
+				return "", newDiscriminatorError(
+					reasonEmptyType, "", valOff,
+					"json: discriminator type at offset %d is empty",
+					valOff)
+			}
+			return tn, nil
+		}
+
+		// Skip over the value.
+		d.value(reflect.Value{})
+
+		// Next token must be , or }.
+		if d.opcode == scanSkipSpace {
+			d.scanWhile(scanSkipSpace)
+		}
+		if d.opcode == scanEndObject {
+			return "", nil
+		}
+		if d.opcode != scanObjectValue {
+			panic(phasePanicMsg)
+		}
+	}
+}
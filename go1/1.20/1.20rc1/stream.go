@@ -20,8 +20,16 @@ type Decoder struct {
 	scan    scanner
 	err     error
 
+	lines     int   // number of lines in the data already scanned
+	lineStart int64 // offset of the beginning of the last line already scanned
+
 	tokenState int
 	tokenStack []int
+
+	typedObjectStarts bool  // see UseTypedObjectStart
+	typedObjectOffset int64 // offset plus one of the last TypedObjectStart
+
+	limitErr error // error returned once the input exceeds MaxInputBytes
 }
 
 // NewDecoder returns a new decoder that reads from r.
@@ -39,8 +47,15 @@ func (dec *Decoder) UseNumber() { dec.d.useNumber = true }
 // DisallowUnknownFields causes the Decoder to return an error when the destination
 // is a struct and the input contains object keys which do not match any
 // non-ignored, exported fields in the destination.
+// The discriminator's type field is not an unknown field.
 func (dec *Decoder) DisallowUnknownFields() { dec.d.disallowUnknownFields = true }
 
+// DisallowTypeNameMismatch causes the Decoder to return an error when a JSON
+// object with a type field is decoded into a map or struct and the type name
+// is not the name of the map or struct type, or of a struct type that embeds
+// it. The type names of objects decoded into interfaces are not affected.
+func (dec *Decoder) DisallowTypeNameMismatch() { dec.d.disallowTypeNameMismatch = true }
+
 // SetDiscriminator tells the decoder to check if JSON objects include a
 // discriminator that specifies the Go type into which the object should be
 // decoded.
@@ -52,6 +67,10 @@ func (dec *Decoder) DisallowUnknownFields() { dec.d.disallowUnknownFields = true
 // An optional typeFn may be provided to enable looking up custom types based
 // on type name strings. Built-in types are handled automatically and will be
 // ignored if they are returned by the typeFn.
+// A JSON object without a type field is decoded into a map[string]interface{}
+// when the value is an empty interface. Please see
+// InterfaceDiscriminator.DefaultType for decoding such objects into other
+// interfaces.
 // Calling SetDiscriminator("", "", nil) disables the discriminator.
 func (dec *Decoder) SetDiscriminator(typeFieldName, valueFieldName string, typeFn DiscriminatorToTypeFunc) {
 	dec.d.discriminatorTypeFieldName = typeFieldName
@@ -59,6 +78,40 @@ func (dec *Decoder) SetDiscriminator(typeFieldName, valueFieldName string, typeF
 	dec.d.discriminatorToTypeFn = typeFn
 }
 
+// SetTypeRegistry specifies the registry used to look up the Go types for
+// the type names encoded in JSON objects. Types are looked up in the
+// registry before they are looked up with the typeFn provided to
+// SetDiscriminator.
+// Calling SetTypeRegistry(nil) removes the registry.
+func (dec *Decoder) SetTypeRegistry(r *TypeRegistry) {
+	dec.d.discriminatorTypeRegistry = r
+}
+
+// SetDiscriminatorLayout specifies where the type name is expected relative
+// to a value decoded into an interface. The external and tuple layouts do
+// not use the type and value field names, so it is not necessary to call
+// SetDiscriminator when using them.
+func (dec *Decoder) SetDiscriminatorLayout(l DiscriminatorLayout) {
+	dec.d.discriminatorLayout = l
+}
+
+// SetUnknownTypeFunc specifies the function used to get the value stored in
+// an interface when a type name cannot be resolved to a Go type, instead of
+// returning an error. The NewUnknownDiscriminated function may be used to
+// store an UnknownDiscriminated placeholder in the interface, which is
+// encoded as the original JSON value.
+// Calling SetUnknownTypeFunc(nil) removes the function.
+func (dec *Decoder) SetUnknownTypeFunc(fn UnknownTypeFunc) {
+	dec.d.discriminatorUnknownTypeFn = fn
+}
+
+// SetDecodePolicy specifies the limits used to decode untrusted input.
+// Please see DecodePolicy for more information.
+func (dec *Decoder) SetDecodePolicy(p DecodePolicy) {
+	dec.d.decodePolicy = p
+	dec.scan.maxDepth = p.MaxDepth
+}
+
 // Decode reads the next JSON-encoded value from its
 // input and stores it in the value pointed to by v.
 //
@@ -70,11 +123,11 @@ func (dec *Decoder) Decode(v any) error {
 	}
 
 	if err := dec.tokenPrepareForDecode(); err != nil {
-		return err
+		return dec.errorAt(err, dec.scanp)
 	}
 
 	if !dec.tokenValueAllowed() {
-		return &SyntaxError{msg: "not at beginning of value", Offset: dec.InputOffset()}
+		return dec.errorAt(&SyntaxError{msg: "not at beginning of value", Offset: dec.InputOffset()}, dec.scanp)
 	}
 
 	// Read whole value into buffer.
@@ -83,12 +136,14 @@ func (dec *Decoder) Decode(v any) error {
 		return err
 	}
 	dec.d.init(dec.buf[dec.scanp : dec.scanp+n])
+	start := dec.InputOffset()
 	dec.scanp += n
 
 	// Don't save err from unmarshal into dec.err:
 	// the connection is still usable since we read a complete JSON
 	// object from it before the error happened.
-	err = dec.d.unmarshal(v)
+	// The offsets of errors from unmarshal are relative to the value.
+	err = dec.errorPosition(dec.d.unmarshal(v), start)
 
 	// fixup token streaming state
 	dec.tokenValueEnd()
@@ -96,6 +151,40 @@ func (dec *Decoder) Decode(v any) error {
 	return err
 }
 
+// DecodeAny reads the next JSON-encoded value from its input and returns it
+// as a new value of the Go type named by its discriminator, the same as if
+// it were decoded into an empty interface. A JSON object without a type
+// field is returned as a map[string]interface{}.
+// If an error occurs then the value decoded before the error, if any, is
+// returned with it.
+func (dec *Decoder) DecodeAny() (interface{}, error) {
+	var v interface{}
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// errorPosition sets the line, column, and excerpt of err, where the offset
+// of err is relative to the offset start in the input stream.
+func (dec *Decoder) errorPosition(err error, start int64) error {
+	if err == nil {
+		return nil
+	}
+	return setErrorPosition(err, dec.buf, start-dec.scanned,
+		dec.lines+1, int(dec.scanned-dec.lineStart)+1)
+}
+
+// errorAt sets the line, column, and excerpt of err, if it is a SyntaxError
+// without them, to those of the byte at the index i in dec.buf. The offsets
+// of the errors returned while reading tokens and values are not all
+// relative to the same byte, so the position is that of the invalid byte.
+func (dec *Decoder) errorAt(err error, i int) error {
+	if e, ok := err.(*SyntaxError); ok && e.Line == 0 {
+		e.Line, e.Column, e.Excerpt = position(dec.buf, int64(i),
+			dec.lines+1, int(dec.scanned-dec.lineStart)+1)
+	}
+	return err
+}
+
 // Buffered returns a reader of the data remaining in the Decoder's
 // buffer. The reader is valid until the next call to Decode.
 func (dec *Decoder) Buffered() io.Reader {
@@ -106,6 +195,7 @@ func (dec *Decoder) Buffered() io.Reader {
 // It returns the length of the encoding.
 func (dec *Decoder) readValue() (int, error) {
 	dec.scan.reset()
+	dec.scan.baseDepth = len(dec.tokenStack)
 
 	scanp := dec.scanp
 	var err error
@@ -134,8 +224,8 @@ Input:
 					break Input
 				}
 			case scanError:
-				dec.err = dec.scan.err
-				return 0, dec.scan.err
+				dec.err = dec.errorAt(dec.scan.err, scanp)
+				return 0, dec.err
 			}
 		}
 
@@ -165,6 +255,10 @@ func (dec *Decoder) refill() error {
 	// Make room to read more into the buffer.
 	// First slide down data already consumed.
 	if dec.scanp > 0 {
+		if i := bytes.LastIndexByte(dec.buf[:dec.scanp], '\n'); i >= 0 {
+			dec.lines += bytes.Count(dec.buf[:i+1], []byte{'\n'})
+			dec.lineStart = dec.scanned + int64(i) + 1
+		}
 		dec.scanned += int64(dec.scanp)
 		n := copy(dec.buf, dec.buf[dec.scanp:])
 		dec.buf = dec.buf[:n]
@@ -179,9 +273,18 @@ func (dec *Decoder) refill() error {
 		dec.buf = newBuf
 	}
 
+	// The data beyond the policy's limit was discarded, so the input
+	// cannot be read again.
+	if dec.limitErr != nil {
+		return dec.limitErr
+	}
+
 	// Read. Delay error for next iteration (after scan).
 	n, err := dec.r.Read(dec.buf[len(dec.buf):cap(dec.buf)])
 	dec.buf = dec.buf[0 : len(dec.buf)+n]
+	if perr := dec.limitInputBytes(); perr != nil {
+		return perr
+	}
 
 	return err
 }
@@ -208,6 +311,9 @@ type Encoder struct {
 	discriminatorTypeFieldName  string
 	discriminatorValueFieldName string
 	discriminatorEncodeMode     DiscriminatorEncodeMode
+	discriminatorTypeRegistry   *TypeRegistry
+	discriminatorTypeNameFn     TypeToDiscriminatorFunc
+	discriminatorLayout         DiscriminatorLayout
 }
 
 // NewEncoder returns a new encoder that writes to w.
@@ -233,6 +339,9 @@ func (enc *Encoder) Encode(v any) error {
 		discriminatorTypeFieldName:  enc.discriminatorTypeFieldName,
 		discriminatorValueFieldName: enc.discriminatorValueFieldName,
 		discriminatorEncodeMode:     enc.discriminatorEncodeMode,
+		discriminatorTypeRegistry:   enc.discriminatorTypeRegistry,
+		discriminatorTypeNameFn:     enc.discriminatorTypeNameFn,
+		discriminatorLayout:         enc.discriminatorLayout,
 	})
 	if err != nil {
 		return err
@@ -298,6 +407,35 @@ func (enc *Encoder) SetDiscriminator(typeFieldName, valueFieldName string, mode
 	enc.discriminatorEncodeMode = mode
 }
 
+// SetTypeRegistry specifies the registry used to look up the type names
+// encoded for values. Types that are not registered are encoded with their
+// default type names unless the mode provided to SetDiscriminator includes
+// DiscriminatorEncodeTypeNameRegisteredOnly.
+// Calling SetTypeRegistry(nil) removes the registry.
+func (enc *Encoder) SetTypeRegistry(r *TypeRegistry) {
+	enc.discriminatorTypeRegistry = r
+}
+
+// SetTypeNameFunc specifies a function used to get the type names encoded
+// for values. If the function returns false for a type, the type name is
+// looked up in the encoder's TypeRegistry, then obtained from the type's
+// JSONTypeName method or "jsontype" struct tag, and finally derived from
+// the type itself.
+// Calling SetTypeNameFunc(nil) removes the function.
+func (enc *Encoder) SetTypeNameFunc(fn TypeToDiscriminatorFunc) {
+	enc.discriminatorTypeNameFn = fn
+}
+
+// SetDiscriminatorLayout specifies where the type name is encoded relative
+// to a value stored in an interface. The external and tuple layouts do not
+// use the type and value field names, so it is not necessary to call
+// SetDiscriminator when using them.
+// The DiscriminatorEncodeTypeNameAllObjects mode and the "typed" struct tag
+// option apply only to the inline layout.
+func (enc *Encoder) SetDiscriminatorLayout(l DiscriminatorLayout) {
+	enc.discriminatorLayout = l
+}
+
 // RawMessage is a raw encoded JSON value.
 // It implements Marshaler and Unmarshaler and can
 // be used to delay JSON decoding or precompute a JSON encoding.
@@ -331,6 +469,7 @@ var _ Unmarshaler = (*RawMessage)(nil)
 //	Number, for JSON numbers
 //	string, for JSON string literals
 //	nil, for JSON null
+//	TypedObjectStart, for the type name of a JSON object, see UseTypedObjectStart
 type Token any
 
 const (
@@ -357,7 +496,7 @@ func (dec *Decoder) tokenPrepareForDecode() error {
 			return err
 		}
 		if c != ',' {
-			return &SyntaxError{"expected comma after array element", dec.InputOffset()}
+			return &SyntaxError{msg: "expected comma after array element", Offset: dec.InputOffset()}
 		}
 		dec.scanp++
 		dec.tokenState = tokenArrayValue
@@ -367,7 +506,7 @@ func (dec *Decoder) tokenPrepareForDecode() error {
 			return err
 		}
 		if c != ':' {
-			return &SyntaxError{"expected colon after object key", dec.InputOffset()}
+			return &SyntaxError{msg: "expected colon after object key", Offset: dec.InputOffset()}
 		}
 		dec.scanp++
 		dec.tokenState = tokenObjectValue
@@ -421,6 +560,12 @@ func (dec *Decoder) Token() (Token, error) {
 			if !dec.tokenValueAllowed() {
 				return dec.tokenError(c)
 			}
+			if err := dec.checkTokenDepth(); err != nil {
+				return nil, err
+			}
+			if tok, err := dec.tokenTypedObjectStart(); tok != nil || err != nil {
+				return tok, err
+			}
 			dec.scanp++
 			dec.tokenStack = append(dec.tokenStack, dec.tokenState)
 			dec.tokenState = tokenArrayStart
@@ -440,6 +585,12 @@ func (dec *Decoder) Token() (Token, error) {
 			if !dec.tokenValueAllowed() {
 				return dec.tokenError(c)
 			}
+			if err := dec.checkTokenDepth(); err != nil {
+				return nil, err
+			}
+			if tok, err := dec.tokenTypedObjectStart(); tok != nil || err != nil {
+				return tok, err
+			}
 			dec.scanp++
 			dec.tokenStack = append(dec.tokenStack, dec.tokenState)
 			dec.tokenState = tokenObjectStart
@@ -504,6 +655,27 @@ func (dec *Decoder) Token() (Token, error) {
 	}
 }
 
+// tokenTypedObjectStart returns a TypedObjectStart for the JSON value that
+// begins with the next byte if it has a type name and one has not been
+// returned for it already.
+func (dec *Decoder) tokenTypedObjectStart() (Token, error) {
+	if !dec.typedObjectStarts || dec.typedObjectOffset == dec.InputOffset()+1 {
+		return nil, nil
+	}
+	if dec.buf[dec.scanp] == '[' && dec.d.discriminatorLayout != DiscriminatorLayoutTuple {
+		return nil, nil
+	}
+	dec.typedObjectOffset = dec.InputOffset() + 1
+	tn, t, err := dec.peekDiscriminator()
+	if err != nil {
+		return nil, err
+	}
+	if tn == "" {
+		return nil, nil
+	}
+	return TypedObjectStart{TypeName: tn, Type: t}, nil
+}
+
 func (dec *Decoder) tokenError(c byte) (Token, error) {
 	var context string
 	switch dec.tokenState {
@@ -520,7 +692,7 @@ func (dec *Decoder) tokenError(c byte) (Token, error) {
 	case tokenObjectComma:
 		context = " after object key:value pair"
 	}
-	return nil, &SyntaxError{"invalid character " + quoteChar(c) + context, dec.InputOffset()}
+	return nil, dec.errorAt(&SyntaxError{msg: "invalid character " + quoteChar(c) + context, Offset: dec.InputOffset()}, dec.scanp)
 }
 
 // More reports whether there is another element in the
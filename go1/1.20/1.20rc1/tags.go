@@ -36,3 +36,17 @@ func (o tagOptions) Contains(optionName string) bool {
 	}
 	return false
 }
+
+// Value returns the value of a comma-separated list of options' name=value
+// option, ex. "kind" for the "discriminator" option in "discriminator=kind".
+func (o tagOptions) Value(optionName string) (string, bool) {
+	s := string(o)
+	for s != "" {
+		var opt string
+		opt, s, _ = strings.Cut(s, ",")
+		if name, value, ok := strings.Cut(opt, "="); ok && name == optionName {
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,352 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// A typeNameParser parses a type name written as a Go type expression:
+//
+//	Type       = "*" Type | "[" "]" Type | "[" Length "]" Type |
+//	             "map" "[" Type "]" Type | StructType | TypeName .
+//	StructType = "struct {}" | "struct { " Field { "; " Field } " }" .
+//	Field      = [ FieldName " " ] Type [ " " Tag ] .
+//	TypeName   = Name [ "[" Type { "," Type } "]" ] .
+//	Name       = a sequence of bytes other than "[", "]", and "," .
+//
+// A Name may be a built-in type name, ex. "interface {}", or a name that is
+// qualified with a package path, ex. "example.com/pkg.Foo". A TypeName with
+// type arguments is the name of an instantiated generic type, and it is
+// looked up as a whole, ex. "Pair[string,Foo]".
+//
+// A StructType is written like the String method of an unnamed struct type,
+// ex. `struct { A int "json:\"a\""; Foo }`, but with the type names of its
+// fields. A FieldName is an exported identifier, and a Tag is a quoted Go
+// string. Inside a StructType a Name also ends at " ", ";", and "}", except
+// for the Name "interface {}".
+type typeNameParser struct {
+	s      string // the type name
+	off    int    // offset of the next byte in s
+	depth  int    // nesting depth of the type being parsed
+	fields int    // nesting depth of the struct fields being parsed
+	policy DecodePolicy
+
+	// lookup returns the type for a TypeName. Types are not constructed
+	// when lookup is nil, so only the syntax of the type name is checked.
+	lookup func(tn string) (reflect.Type, bool)
+}
+
+// parse returns the type for the entire type name.
+func (p *typeNameParser) parse() (reflect.Type, error) {
+	t, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if p.off < len(p.s) {
+		return nil, p.syntaxError()
+	}
+	return t, nil
+}
+
+func (p *typeNameParser) syntaxError() error {
+	return fmt.Errorf("json: invalid discriminator type syntax at offset %d: %s", p.off, p.s)
+}
+
+// consume reports whether s is next in the type name, advancing past it if
+// it is.
+func (p *typeNameParser) consume(s string) bool {
+	if strings.HasPrefix(p.s[p.off:], s) {
+		p.off += len(s)
+		return true
+	}
+	return false
+}
+
+// parseType parses a Type.
+func (p *typeNameParser) parseType() (reflect.Type, error) {
+	if p.depth++; p.depth > maxNestingDepth {
+		return nil, fmt.Errorf("json: discriminator type exceeded max depth: %s", p.s)
+	}
+	defer func() { p.depth-- }()
+
+	start := p.off
+	switch {
+	case p.consume("*"):
+		return p.parseComposite(start, reflect.Ptr, -1, nil)
+	case p.consume("[]"):
+		return p.parseComposite(start, reflect.Slice, -1, nil)
+	case p.consume("["):
+		n := 0
+		for p.off+n < len(p.s) && '0' <= p.s[p.off+n] && p.s[p.off+n] <= '9' {
+			n++
+		}
+		length, err := strconv.Atoi(p.s[p.off : p.off+n])
+		if err != nil {
+			return nil, p.syntaxError()
+		}
+		p.off += n
+		if !p.consume("]") {
+			return nil, p.syntaxError()
+		}
+		return p.parseComposite(start, reflect.Array, length, nil)
+	case p.consume("struct {"):
+		return p.parseStruct(start)
+	case p.consume("map["):
+		kt, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume("]") {
+			return nil, p.syntaxError()
+		}
+		return p.parseComposite(start, reflect.Map, -1, kt)
+	}
+	return p.parseTypeName()
+}
+
+// parseComposite parses the element type of the pointer, slice, array, or
+// map type that begins at the offset start, returning the composite type.
+func (p *typeNameParser) parseComposite(
+	start int, kind reflect.Kind, length int, kt reflect.Type) (reflect.Type, error) {
+
+	et, err := p.parseType()
+	if err != nil || p.lookup == nil {
+		return nil, err
+	}
+
+	// Check the policy before the type is constructed.
+	tn := p.s[start:p.off]
+	if err := p.policy.checkComposite(tn); err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case reflect.Ptr:
+		return cachedPointerType(et), nil
+	case reflect.Slice:
+		return reflect.SliceOf(et), nil
+	case reflect.Array:
+		if err := p.policy.checkArrayLen(tn, length, et); err != nil {
+			return nil, err
+		}
+		if et.Size() > 0 && uintptr(length) > ^uintptr(0)/et.Size() {
+			return nil, fmt.Errorf("json: discriminator type is too large: %s", tn)
+		}
+		if err := p.policy.checkTypeSize(tn, uint64(length)*uint64(et.Size())); err != nil {
+			return nil, err
+		}
+		return reflect.ArrayOf(length, et), nil
+	default:
+		if !kt.Comparable() {
+			return nil, fmt.Errorf("json: invalid map key type %s in discriminator type: %s", kt, tn)
+		}
+		return reflect.MapOf(kt, et), nil
+	}
+}
+
+// parseStruct parses the fields of the struct type that begins at the offset
+// start, returning the struct type. The "struct {" has been read already.
+func (p *typeNameParser) parseStruct(start int) (reflect.Type, error) {
+	var fields []reflect.StructField
+	if !p.consume("}") {
+		if !p.consume(" ") {
+			return nil, p.syntaxError()
+		}
+		p.fields++
+		for {
+			f, err := p.parseField()
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, f)
+			if p.consume(" }") {
+				break
+			}
+			if !p.consume("; ") {
+				return nil, p.syntaxError()
+			}
+		}
+		p.fields--
+	}
+	if p.lookup == nil {
+		return nil, nil
+	}
+
+	// Check the policy before the type is constructed.
+	tn := p.s[start:p.off]
+	if err := p.policy.checkComposite(tn); err != nil {
+		return nil, err
+	}
+	t, err := p.structOf(tn, fields)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.policy.checkTypeSize(tn, uint64(t.Size())); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// parseField parses a Field of a struct type.
+func (p *typeNameParser) parseField() (reflect.StructField, error) {
+	var f reflect.StructField
+
+	// The field name is followed by a space and the field's type. Otherwise
+	// the field is embedded and it is named after its type.
+	start := p.off
+	p.skipName()
+	if p.off < len(p.s)-1 && p.s[p.off] == ' ' && p.s[p.off+1] != '"' && p.s[p.off+1] != '}' {
+		f.Name = p.s[start:p.off]
+		if !isExportedIdent(f.Name) {
+			return f, p.syntaxError()
+		}
+		p.off++
+	} else {
+		p.off = start
+		f.Anonymous = true
+	}
+
+	t, err := p.parseType()
+	if err != nil {
+		return f, err
+	}
+	f.Type = t
+
+	if p.consume(" \"") {
+		p.off--
+		q, err := strconv.QuotedPrefix(p.s[p.off:])
+		if err != nil {
+			return f, p.syntaxError()
+		}
+		tag, _ := strconv.Unquote(q)
+		f.Tag = reflect.StructTag(tag)
+		p.off += len(q)
+	}
+
+	if f.Anonymous && t != nil {
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if f.Name = t.Name(); !isExportedIdent(f.Name) {
+			return f, fmt.Errorf("json: invalid embedded field %s in discriminator type: %s", t, p.s)
+		}
+	}
+	return f, nil
+}
+
+// structOf returns the struct type with the fields parsed from the type
+// name tn, or an error if the type cannot be constructed.
+func (p *typeNameParser) structOf(tn string, fields []reflect.StructField) (t reflect.Type, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			t, err = nil, fmt.Errorf("json: invalid discriminator type %s: %v", tn, r)
+		}
+	}()
+	return reflect.StructOf(fields), nil
+}
+
+// parseTypeName parses a TypeName and looks it up.
+func (p *typeNameParser) parseTypeName() (reflect.Type, error) {
+	start := p.off
+	if !p.consume("interface {}") {
+		p.skipName()
+	}
+	if p.off == start {
+		return nil, p.syntaxError()
+	}
+
+	// Parse the type arguments of an instantiated generic type so the
+	// closing ] is found.
+	if p.consume("[") {
+		lookup := p.lookup
+		p.lookup = nil
+		for {
+			if _, err := p.parseType(); err != nil {
+				return nil, err
+			}
+			if !p.consume(",") {
+				break
+			}
+		}
+		p.lookup = lookup
+		if !p.consume("]") {
+			return nil, p.syntaxError()
+		}
+	}
+
+	if p.lookup == nil {
+		return nil, nil
+	}
+	tn := p.s[start:p.off]
+	t, ok := p.lookup(tn)
+	if !ok {
+		if tn != p.s {
+			return nil, fmt.Errorf("json: invalid type %s in discriminator type: %s", tn, p.s)
+		}
+		return nil, fmt.Errorf("json: invalid discriminator type: %s", tn)
+	}
+	return t, nil
+}
+
+// skipName advances past the Name that begins at the current offset.
+func (p *typeNameParser) skipName() {
+	for p.off < len(p.s) && !p.isDelim(p.s[p.off]) {
+		p.off++
+	}
+}
+
+// isDelim reports whether c ends a Name.
+func (p *typeNameParser) isDelim(c byte) bool {
+	switch c {
+	case '[', ']', ',':
+		return true
+	case ' ', ';', '}':
+		return p.fields > 0
+	}
+	return false
+}
+
+// isExportedIdent reports whether s is an exported Go identifier.
+func isExportedIdent(s string) bool {
+	for i, r := range s {
+		if i == 0 && !unicode.IsUpper(r) {
+			return false
+		}
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isValidTypeName reports whether the type name tn may be parsed by
+// discriminatorParseTypeName.
+func isValidTypeName(tn string) bool {
+	p := typeNameParser{s: tn}
+	_, err := p.parse()
+	return err == nil
+}
+
+// discriminatorValidTypeNameCache caches whether the encoded type names may
+// be parsed. The names are cached rather than the types since the name of a
+// type depends on the encode options.
+var discriminatorValidTypeNameCache sync.Map // map[string]bool
+
+// cachedIsValidTypeName is like isValidTypeName but parses each type name
+// only once.
+func cachedIsValidTypeName(tn string) bool {
+	if value, ok := discriminatorValidTypeNameCache.Load(tn); ok {
+		return value.(bool)
+	}
+	ok := isValidTypeName(tn)
+	discriminatorValidTypeNameCache.Store(tn, ok)
+	return ok
+}
@@ -7,6 +7,7 @@
 package json
 
 import (
+	"bytes"
 	"io"
 
 	json "github.com/akutz/gdj/go1/1.19/1.19.4"
@@ -33,12 +34,215 @@ const (
 	// DiscriminatorEncodeTypeNameWithPath causes the type name to be encoded
 	// prefixed with the type's full package path.
 	DiscriminatorEncodeTypeNameWithPath = json.DiscriminatorEncodeTypeNameWithPath
+
+	// DiscriminatorEncodeTypeNameRegisteredOnly causes an error to be
+	// returned when encoding the type name of a named type that is not
+	// registered with the encoder's TypeRegistry. Built-in types are always
+	// registered.
+	DiscriminatorEncodeTypeNameRegisteredOnly = json.DiscriminatorEncodeTypeNameRegisteredOnly
+
+	// DiscriminatorEncodeTypeNameTypeArgsWithPath causes the type arguments
+	// of instantiated generic types to be encoded prefixed with their full
+	// package paths, ex. "Box[example.com/pkg.Foo]" instead of "Box[Foo]".
+	// Type arguments are always prefixed with their full package paths when
+	// DiscriminatorEncodeTypeNameWithPath is set.
+	DiscriminatorEncodeTypeNameTypeArgsWithPath = json.DiscriminatorEncodeTypeNameTypeArgsWithPath
+
+	// DiscriminatorEncodeTypeNamePointers causes a pointer stored in an
+	// interface to be encoded with the name of the pointer type, ex. "*Dog",
+	// instead of the name of the type to which it points, so the pointer
+	// is decoded as a pointer rather than a value.
+	DiscriminatorEncodeTypeNamePointers = json.DiscriminatorEncodeTypeNamePointers
+
+	// DiscriminatorEncodeTypeNameOmitUnparseable causes a value whose type
+	// name cannot be parsed when it is decoded, ex. an anonymous struct with
+	// an unexported field, to be encoded without a type name instead of
+	// returning an error.
+	DiscriminatorEncodeTypeNameOmitUnparseable = json.DiscriminatorEncodeTypeNameOmitUnparseable
+
+	// DiscriminatorEncodeTypeNameQualifiedElems causes the named key,
+	// element, and field types of unnamed types to be encoded as they are by
+	// the String method of the unnamed type, ex. "[]pkg.Dog" instead of
+	// "[]Dog".
+	DiscriminatorEncodeTypeNameQualifiedElems = json.DiscriminatorEncodeTypeNameQualifiedElems
+)
+
+// DiscriminatorLayout describes where the type name is encoded relative to
+// a value stored in an interface.
+type DiscriminatorLayout = json.DiscriminatorLayout
+
+const (
+	// DiscriminatorLayoutInline is the default layout. The type name is
+	// encoded as a field of map and struct values, and all other values are
+	// encoded inside an outer JSON object.
+	DiscriminatorLayoutInline = json.DiscriminatorLayoutInline
+
+	// DiscriminatorLayoutExternal encodes values inside an outer JSON object
+	// with a single field named after the type.
+	DiscriminatorLayoutExternal = json.DiscriminatorLayoutExternal
+
+	// DiscriminatorLayoutAdjacent encodes all values inside an outer JSON
+	// object with a field that specifies the type name and a field that
+	// specifies the value.
+	DiscriminatorLayoutAdjacent = json.DiscriminatorLayoutAdjacent
+
+	// DiscriminatorLayoutTuple encodes values as a JSON array with two
+	// elements, the type name and the value.
+	DiscriminatorLayoutTuple = json.DiscriminatorLayoutTuple
 )
 
 // DiscriminatorToTypeFunc is used to get a reflect.Type from its
 // discriminator.
 type DiscriminatorToTypeFunc = json.DiscriminatorToTypeFunc
 
+// TypeToDiscriminatorFunc is used to get the discriminator for a
+// reflect.Type.
+type TypeToDiscriminatorFunc = json.TypeToDiscriminatorFunc
+
+// TypeNamer is the interface implemented by types that provide the type
+// names with which they are encoded by the discriminator.
+type TypeNamer = json.TypeNamer
+
+// UnknownTypeFunc is used to get the value stored in an interface when the
+// type name of a discriminated JSON value cannot be resolved to a Go type.
+type UnknownTypeFunc = json.UnknownTypeFunc
+
+// UnknownDiscriminated is a placeholder for a discriminated JSON value with
+// a type name that cannot be resolved to a Go type.
+type UnknownDiscriminated = json.UnknownDiscriminated
+
+// NewUnknownDiscriminated is an UnknownTypeFunc that returns an
+// UnknownDiscriminated placeholder for the JSON value.
+func NewUnknownDiscriminated(typeName string, data RawMessage) (interface{}, error) {
+	return json.NewUnknownDiscriminated(typeName, data)
+}
+
+// A TypedObjectStart is returned by Decoder.Token in place of the Delim
+// that begins a discriminated JSON value when UseTypedObjectStart has been
+// called.
+type TypedObjectStart = json.TypedObjectStart
+
+// A TypeRegistry maps type names to Go types and Go types to type names so
+// the type names written by an Encoder are the same type names understood by
+// a Decoder.
+type TypeRegistry = json.TypeRegistry
+
+// An InterfaceDiscriminator describes the discriminator used to encode and
+// decode the values stored in a specific interface type.
+type InterfaceDiscriminator = json.InterfaceDiscriminator
+
+// NewTypeRegistry returns a new TypeRegistry. Type names that are not found
+// in the new registry are looked up in the parent registries in the order
+// in which they were provided.
+func NewTypeRegistry(parents ...*TypeRegistry) *json.TypeRegistry {
+	return json.NewTypeRegistry(parents...)
+}
+
+// An Encoder writes JSON values to an output stream.
+type Encoder = json.Encoder
+
+// A Decoder reads and decodes JSON values from an input stream.
+type Decoder = json.Decoder
+
+// Marshaler is the interface implemented by types that
+// can marshal themselves into valid JSON.
+type Marshaler = json.Marshaler
+
+// Unmarshaler is the interface implemented by types
+// that can unmarshal a JSON description of themselves.
+type Unmarshaler = json.Unmarshaler
+
+// MarshalerWithOptions is the interface implemented by types that can
+// marshal themselves into valid JSON using the options of the Encoder,
+// Codec, or Marshal call that is encoding them.
+type MarshalerWithOptions = json.MarshalerWithOptions
+
+// UnmarshalerWithOptions is the interface implemented by types that can
+// unmarshal a JSON description of themselves using the options of the
+// Decoder, Codec, or Unmarshal call that is decoding them.
+type UnmarshalerWithOptions = json.UnmarshalerWithOptions
+
+// RawMessage is a raw encoded JSON value.
+// It implements Marshaler and Unmarshaler and can
+// be used to delay JSON decoding or precompute a JSON encoding.
+type RawMessage = json.RawMessage
+
+// A Number represents a JSON number literal.
+type Number = json.Number
+
+// A Token holds a value of one of these types:
+//
+//	Delim, for the four JSON delimiters [ ] { }
+//	bool, for JSON booleans
+//	float64, for JSON numbers
+//	Number, for JSON numbers
+//	string, for JSON string literals
+//	nil, for JSON null
+type Token = json.Token
+
+// A Delim is a JSON array or object delimiter, one of [ ] { or }.
+type Delim = json.Delim
+
+// A SyntaxError is a description of a JSON syntax error.
+type SyntaxError = json.SyntaxError
+
+// An UnmarshalTypeError describes a JSON value that was
+// not appropriate for a value of a specific Go type.
+type UnmarshalTypeError = json.UnmarshalTypeError
+
+// A DecodePolicy limits the resources used to decode untrusted JSON input
+// and the Go types that may be constructed from the type names in it.
+type DecodePolicy = json.DecodePolicy
+
+// A PolicyError describes JSON input that exceeds a limit of a
+// DecodePolicy.
+type PolicyError = json.PolicyError
+
+// A DiscriminatorError describes a discriminated JSON value that could not
+// be decoded into an interface.
+type DiscriminatorError = json.DiscriminatorError
+
+// An UnmarshalFieldError describes a JSON object key that
+// led to an unexported (and therefore unwritable) struct field.
+//
+// Deprecated: No longer used; kept for compatibility.
+type UnmarshalFieldError = json.UnmarshalFieldError
+
+// An InvalidUnmarshalError describes an invalid argument passed to Unmarshal.
+// (The argument to Unmarshal must be a non-nil pointer.)
+type InvalidUnmarshalError = json.InvalidUnmarshalError
+
+// An UnsupportedTypeError is returned by Marshal when attempting
+// to encode an unsupported value type.
+type UnsupportedTypeError = json.UnsupportedTypeError
+
+// An UnsupportedValueError is returned by Marshal when attempting
+// to encode an unsupported value.
+type UnsupportedValueError = json.UnsupportedValueError
+
+// Before Go 1.2, an InvalidUTF8Error was returned by Marshal when
+// attempting to encode a string value with invalid UTF-8 sequences.
+//
+// Deprecated: No longer used; kept for compatibility.
+type InvalidUTF8Error = json.InvalidUTF8Error
+
+// A MarshalerError represents an error from calling a MarshalJSON or MarshalText method.
+type MarshalerError = json.MarshalerError
+
+// CodecOptions describes the options used by a Codec to encode and decode
+// values.
+type CodecOptions = json.CodecOptions
+
+// A Codec encodes and decodes JSON values using a fixed set of options so
+// the same wire convention may be defined once and shared by callers.
+// A Codec is immutable and safe for concurrent use by multiple goroutines.
+type Codec = json.Codec
+
+// NewCodec returns a new Codec that uses the provided options.
+func NewCodec(opts CodecOptions) *json.Codec {
+	return json.NewCodec(opts)
+}
+
 // NewEncoder returns a new encoder that writes to w.
 func NewEncoder(w io.Writer) *json.Encoder {
 	return json.NewEncoder(w)
@@ -51,3 +255,63 @@ func NewEncoder(w io.Writer) *json.Encoder {
 func NewDecoder(r io.Reader) *json.Decoder {
 	return json.NewDecoder(r)
 }
+
+// Marshal returns the JSON encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// MarshalIndent is like Marshal but applies Indent to format the output.
+func MarshalIndent(v interface{}, prefix, indent string) ([]byte, error) {
+	return json.MarshalIndent(v, prefix, indent)
+}
+
+// MarshalWithDiscriminator is like Marshal but encodes the type information
+// for values stored in interfaces.
+func MarshalWithDiscriminator(
+	v interface{},
+	typeFieldName, valueFieldName string,
+	mode DiscriminatorEncodeMode) ([]byte, error) {
+
+	return json.MarshalWithDiscriminator(v, typeFieldName, valueFieldName, mode)
+}
+
+// Unmarshal parses the JSON-encoded data and stores the result
+// in the value pointed to by v.
+func Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// UnmarshalWithDiscriminator is like Unmarshal but uses the type information
+// encoded in JSON objects to decode values into interfaces.
+func UnmarshalWithDiscriminator(
+	data []byte,
+	v interface{},
+	typeFieldName, valueFieldName string,
+	typeFn DiscriminatorToTypeFunc) error {
+
+	return json.UnmarshalWithDiscriminator(data, v, typeFieldName, valueFieldName, typeFn)
+}
+
+// Valid reports whether data is a valid JSON encoding.
+func Valid(data []byte) bool {
+	return json.Valid(data)
+}
+
+// Compact appends to dst the JSON-encoded src with
+// insignificant space characters elided.
+func Compact(dst *bytes.Buffer, src []byte) error {
+	return json.Compact(dst, src)
+}
+
+// Indent appends to dst an indented form of the JSON-encoded src.
+func Indent(dst *bytes.Buffer, src []byte, prefix, indent string) error {
+	return json.Indent(dst, src, prefix, indent)
+}
+
+// HTMLEscape appends to dst the JSON-encoded src with <, >, &, U+2028 and U+2029
+// characters inside string literals changed to \u003c, \u003e, \u0026, \u2028, \u2029
+// so that the JSON will be safe to embed inside HTML <script> tags.
+func HTMLEscape(dst *bytes.Buffer, src []byte) {
+	json.HTMLEscape(dst, src)
+}
@@ -0,0 +1,242 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"reflect"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+type animal interface {
+	sound() string
+}
+
+type animalDog struct {
+	Name string `json:"name"`
+}
+
+func (animalDog) sound() string { return "woof" }
+
+type animalCat struct {
+	Name string `json:"name"`
+}
+
+func (*animalCat) sound() string { return "meow" }
+
+type animalFish uint8
+
+func (animalFish) sound() string { return "blub" }
+
+type animalOwner struct {
+	Pet   animal      `json:"pet"`
+	Other interface{} `json:"other,omitempty"`
+}
+
+var animalType = reflect.TypeOf((*animal)(nil)).Elem()
+
+func newAnimalRegistryForTests(t *testing.T, allowed ...reflect.Type) *json.TypeRegistry {
+	types := json.NewTypeRegistry()
+	if err := types.Register(reflect.TypeOf(animalDog{}), "dog"); err != nil {
+		t.Fatal(err)
+	}
+	if err := types.Register(reflect.TypeOf(animalCat{}), "cat"); err != nil {
+		t.Fatal(err)
+	}
+	if err := types.Register(reflect.TypeOf(animalFish(0)), "fish"); err != nil {
+		t.Fatal(err)
+	}
+	r := json.NewTypeRegistry()
+	if err := r.RegisterInterface(animalType, json.InterfaceDiscriminator{
+		TypeFieldName:  "kind",
+		ValueFieldName: "value",
+		Types:          types,
+		AllowedTypes:   allowed,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestInterfaceDiscriminator(t *testing.T) {
+	t.Run("Without global discriminator", func(t *testing.T) {
+		c := json.NewCodec(json.CodecOptions{
+			TypeRegistry: newAnimalRegistryForTests(t),
+		})
+		for _, tc := range []struct {
+			obj animalOwner
+			str string
+		}{
+			{obj: animalOwner{Pet: animalDog{Name: "a"}}, str: `{"pet":{"kind":"dog","name":"a"}}`},
+			{obj: animalOwner{Pet: &animalCat{Name: "a"}}, str: `{"pet":{"kind":"cat","name":"a"}}`},
+			{obj: animalOwner{Pet: animalFish(1)}, str: `{"pet":{"kind":"fish","value":1}}`},
+			{obj: animalOwner{Pet: animalDog{Name: "a"}, Other: map[string]interface{}{"a": 1.0}}, str: `{"pet":{"kind":"dog","name":"a"},"other":{"a":1}}`},
+		} {
+			data, err := c.Marshal(tc.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := string(data), tc.str; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			var obj animalOwner
+			if err := c.Unmarshal(data, &obj); err != nil {
+				t.Fatal(err)
+			}
+			assertDeepEqual(t, obj, tc.obj)
+		}
+	})
+
+	t.Run("With global discriminator", func(t *testing.T) {
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeFn:         discriminatorToTypeFn,
+			TypeRegistry:   newAnimalRegistryForTests(t),
+		})
+		obj := animalOwner{
+			Pet:   animalDog{Name: "a"},
+			Other: DS1{F1: uint8(1)},
+		}
+		data, err := c.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, e := string(data), `{"pet":{"kind":"dog","name":"a"},"other":{"_t":"DS1","f1":{"_t":"uint8","_v":1}}}`; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+		var obj2 animalOwner
+		if err := c.Unmarshal(data, &obj2); err != nil {
+			t.Fatal(err)
+		}
+		assertDeepEqual(t, obj2, obj)
+	})
+
+	t.Run("Map value", func(t *testing.T) {
+		types := json.NewTypeRegistry()
+		if err := types.Register(reflect.TypeOf(map[string]int{}), "ints"); err != nil {
+			t.Fatal(err)
+		}
+		r := json.NewTypeRegistry()
+		if err := r.RegisterInterface(reflect.TypeOf((*interface{})(nil)).Elem(), json.InterfaceDiscriminator{
+			TypeFieldName:  "kind",
+			ValueFieldName: "value",
+			Types:          types,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		c := json.NewCodec(json.CodecOptions{TypeRegistry: r})
+		data, err := c.Marshal(DS1{F1: map[string]int{"a": 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, e := string(data), `{"f1":{"kind":"ints","a":1}}`; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+		var obj DS1
+		if err := c.Unmarshal(data, &obj); err != nil {
+			t.Fatal(err)
+		}
+		assertDeepEqual(t, obj, DS1{F1: map[string]int{"a": 1}})
+	})
+
+	t.Run("Interface type field", func(t *testing.T) {
+		// The interface's type field is skipped rather than the global one,
+		// whether or not it is the first field of the object.
+		types := json.NewTypeRegistry()
+		if err := types.Register(reflect.TypeOf(typeFieldCollision{}), "collision"); err != nil {
+			t.Fatal(err)
+		}
+		if err := types.Register(reflect.TypeOf(map[string]string{}), "strs"); err != nil {
+			t.Fatal(err)
+		}
+		r := json.NewTypeRegistry()
+		if err := r.RegisterInterface(reflect.TypeOf((*interface{})(nil)).Elem(), json.InterfaceDiscriminator{
+			TypeFieldName:  "kind",
+			ValueFieldName: "value",
+			Types:          types,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeRegistry:   r,
+		})
+		for _, tc := range []struct {
+			str string
+			obj DS1
+		}{
+			{str: `{"f1":{"kind":"collision","_t":"x"}}`, obj: DS1{F1: typeFieldCollision{Type: "x"}}},
+			{str: `{"f1":{"_t":"x","kind":"collision"}}`, obj: DS1{F1: typeFieldCollision{Type: "x"}}},
+			{str: `{"f1":{"kind":"strs","_t":"x"}}`, obj: DS1{F1: map[string]string{"_t": "x"}}},
+			{str: `{"f1":{"_t":"x","kind":"strs"}}`, obj: DS1{F1: map[string]string{"_t": "x"}}},
+		} {
+			var obj DS1
+			if err := c.Unmarshal([]byte(tc.str), &obj); err != nil {
+				t.Fatalf("%s: %v", tc.str, err)
+			}
+			assertDeepEqual(t, obj, tc.obj)
+		}
+	})
+
+	t.Run("Allowed types", func(t *testing.T) {
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeFn: func(name string) (reflect.Type, bool) {
+				if name == "fish" {
+					return reflect.TypeOf(animalFish(0)), true
+				}
+				return nil, false
+			},
+			TypeRegistry: newAnimalRegistryForTests(
+				t, reflect.TypeOf(animalDog{}), reflect.TypeOf(&animalCat{})),
+		})
+		for _, obj := range []animalOwner{
+			{Pet: animalDog{Name: "a"}},
+			{Pet: &animalCat{Name: "a"}},
+		} {
+			data, err := c.Marshal(obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var obj2 animalOwner
+			if err := c.Unmarshal(data, &obj2); err != nil {
+				t.Fatal(err)
+			}
+			assertDeepEqual(t, obj2, obj)
+		}
+
+		_, err := c.Marshal(animalOwner{Pet: animalFish(1)})
+		if a, e := err, `json: discriminator type json_test.animalFish is not allowed for json_test.animal`; a == nil || a.Error() != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+		}
+		var obj animalOwner
+		err = c.Unmarshal([]byte(`{"pet":{"kind":"fish","value":1}}`), &obj)
+		if a, e := err, `json: discriminator type fish is not allowed for json_test.animal`; a == nil || a.Error() != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+		}
+	})
+
+	t.Run("Register errors", func(t *testing.T) {
+		r := newAnimalRegistryForTests(t)
+		for _, tc := range []struct {
+			typ reflect.Type
+			id  json.InterfaceDiscriminator
+			err string
+		}{
+			{typ: reflect.TypeOf(animalDog{}), err: `json: cannot register non-interface type json_test.animalDog`},
+			{typ: animalType, err: `json: interface json_test.animal already registered`},
+			{typ: reflect.TypeOf((*noop1)(nil)).Elem(), id: json.InterfaceDiscriminator{AllowedTypes: []reflect.Type{reflect.TypeOf(animalDog{})}}, err: `json: allowed type json_test.animalDog does not implement json_test.noop1`},
+		} {
+			err := r.RegisterInterface(tc.typ, tc.id)
+			if a, e := err, tc.err; a == nil || a.Error() != e {
+				t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+			}
+		}
+	})
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+func TestDiscriminatorLayout(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		layout json.DiscriminatorLayout
+		tf, vf string
+		obj    interface{}
+		str    string
+	}{
+		{name: "External struct", layout: json.DiscriminatorLayoutExternal, obj: DS1{F1: DS3{F1: "a"}}, str: `{"f1":{"DS3":{"f1":"a"}}}`},
+		{name: "External nested struct", layout: json.DiscriminatorLayoutExternal, obj: DS1{F1: DS4{F1: "a", F2: int64(2)}}, str: `{"f1":{"DS4":{"f1":"a","f2":{"int64":2}}}}`},
+		{name: "External map", layout: json.DiscriminatorLayoutExternal, obj: DS1{F1: mapStringIntNoop{"a": 1}}, str: `{"f1":{"mapStringIntNoop":{"a":1}}}`},
+		{name: "External primitive", layout: json.DiscriminatorLayoutExternal, obj: DS1{F1: uint8(1)}, str: `{"f1":{"uint8":1}}`},
+		{name: "External nil", layout: json.DiscriminatorLayoutExternal, obj: DS1{}, str: `{"f1":null}`},
+		{name: "Adjacent struct", layout: json.DiscriminatorLayoutAdjacent, tf: "_t", vf: "_v", obj: DS1{F1: DS3{F1: "a"}}, str: `{"f1":{"_t":"DS3","_v":{"f1":"a"}}}`},
+		{name: "Adjacent map", layout: json.DiscriminatorLayoutAdjacent, tf: "_t", vf: "_v", obj: DS1{F1: mapStringIntNoop{"a": 1}}, str: `{"f1":{"_t":"mapStringIntNoop","_v":{"a":1}}}`},
+		{name: "Adjacent primitive", layout: json.DiscriminatorLayoutAdjacent, tf: "_t", vf: "_v", obj: DS1{F1: uint8(1)}, str: `{"f1":{"_t":"uint8","_v":1}}`},
+		{name: "Tuple struct", layout: json.DiscriminatorLayoutTuple, obj: DS1{F1: DS3{F1: "a"}}, str: `{"f1":["DS3",{"f1":"a"}]}`},
+		{name: "Tuple slice", layout: json.DiscriminatorLayoutTuple, obj: DS1{F1: sliceIntNoop{1, 2}}, str: `{"f1":["sliceIntNoop",[1,2]]}`},
+		{name: "Tuple primitive", layout: json.DiscriminatorLayoutTuple, obj: DS1{F1: uint8(1)}, str: `{"f1":["uint8",1]}`},
+		{name: "Tuple nil", layout: json.DiscriminatorLayoutTuple, obj: DS1{}, str: `{"f1":null}`},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			c := json.NewCodec(json.CodecOptions{
+				TypeFieldName:  tc.tf,
+				ValueFieldName: tc.vf,
+				TypeFn:         discriminatorToTypeFn,
+				Layout:         tc.layout,
+			})
+			data, err := c.Marshal(tc.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := string(data), tc.str; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			var w bytes.Buffer
+			if err := c.NewEncoder(&w).Encode(tc.obj); err != nil {
+				t.Fatal(err)
+			}
+			if a, e := w.String(), tc.str+"\n"; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			obj := reflect.New(reflect.TypeOf(tc.obj))
+			if err := c.Unmarshal(data, obj.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			assertDeepEqual(t, obj.Elem().Interface(), tc.obj)
+		})
+	}
+
+	t.Run("Interface layout", func(t *testing.T) {
+		types := json.NewTypeRegistry()
+		if err := types.Register(reflect.TypeOf(animalDog{}), "dog"); err != nil {
+			t.Fatal(err)
+		}
+		r := json.NewTypeRegistry()
+		if err := r.RegisterInterface(animalType, json.InterfaceDiscriminator{
+			Types:  types,
+			Layout: json.DiscriminatorLayoutTuple,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeFn:         discriminatorToTypeFn,
+			TypeRegistry:   r,
+		})
+		obj := animalOwner{Pet: animalDog{Name: "a"}, Other: DS3{F1: "b"}}
+		data, err := c.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, e := string(data), `{"pet":["dog",{"name":"a"}],"other":{"_t":"DS3","f1":"b"}}`; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+		var obj2 animalOwner
+		if err := c.Unmarshal(data, &obj2); err != nil {
+			t.Fatal(err)
+		}
+		assertDeepEqual(t, obj2, obj)
+	})
+
+	t.Run("Decode errors", func(t *testing.T) {
+		for _, tc := range []struct {
+			layout json.DiscriminatorLayout
+			str    string
+			err    string
+		}{
+			{layout: json.DiscriminatorLayoutExternal, str: `{"f1":{}}`, err: `json: missing discriminator`},
+			{layout: json.DiscriminatorLayoutExternal, str: `{"f1":{"DS3":{},"DS4":{}}}`, err: `json: externally discriminated object at offset 7 has more than one field`},
+			{layout: json.DiscriminatorLayoutExternal, str: `{"f1":{"":1}}`, err: `json: discriminator type at offset 7 is empty`},
+			{layout: json.DiscriminatorLayoutAdjacent, str: `{"f1":{"_t":"DS3"}}`, err: `json: missing discriminator value at offset 6`},
+			{layout: json.DiscriminatorLayoutTuple, str: `{"f1":[1,{}]}`, err: `json: discriminator type at offset 7 is not string`},
+			{layout: json.DiscriminatorLayoutTuple, str: `{"f1":["DS3"]}`, err: `json: missing discriminator value at offset 7`},
+			{layout: json.DiscriminatorLayoutTuple, str: `{"f1":["DS3",{},1]}`, err: `json: discriminated array at offset 7 has more than two elements`},
+		} {
+			c := json.NewCodec(json.CodecOptions{
+				TypeFieldName:  "_t",
+				ValueFieldName: "_v",
+				TypeFn:         discriminatorToTypeFn,
+				Layout:         tc.layout,
+			})
+			var obj DS1
+			err := c.Unmarshal([]byte(tc.str), &obj)
+			if a, e := err, tc.err; a == nil || a.Error() != e {
+				t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+			}
+		}
+	})
+}
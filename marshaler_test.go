@@ -0,0 +1,155 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	json "github.com/akutz/gdj"
+)
+
+type marshalerPoint struct {
+	X, Y int
+}
+
+func (p marshalerPoint) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("[%d,%d]", p.X, p.Y)), nil
+}
+
+func (p *marshalerPoint) UnmarshalJSON(data []byte) error {
+	var xy [2]int
+	if err := json.Unmarshal(data, &xy); err != nil {
+		return err
+	}
+	p.X, p.Y = xy[0], xy[1]
+	return nil
+}
+
+type textMarshalerColor struct {
+	R, G, B uint8
+}
+
+func (c textMarshalerColor) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)), nil
+}
+
+func (c *textMarshalerColor) UnmarshalText(data []byte) error {
+	_, err := fmt.Sscanf(string(data), "#%02x%02x%02x", &c.R, &c.G, &c.B)
+	return err
+}
+
+type marshalerObject map[string]int
+
+func (m marshalerObject) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"n":%d}`, m["n"])), nil
+}
+
+// unmarshalerRaw records the data given to its UnmarshalJSON method.
+type unmarshalerRaw struct {
+	Raw string
+}
+
+func (u *unmarshalerRaw) UnmarshalJSON(data []byte) error {
+	u.Raw = string(data)
+	return nil
+}
+
+func TestMarshalerInInterface(t *testing.T) {
+	r := json.NewTypeRegistry()
+	for _, obj := range []interface{}{
+		time.Time{}, marshalerPoint{}, textMarshalerColor{}, marshalerObject{}, unmarshalerRaw{},
+	} {
+		if err := r.Register(reflect.TypeOf(obj), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name   string
+		layout json.DiscriminatorLayout
+		obj    interface{}
+		str    string
+	}{
+		{
+			name: "time.Time",
+			obj:  DS1{F1: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)},
+			str:  `{"f1":{"_t":"Time","_v":"2023-01-02T03:04:05Z"}}`,
+		},
+		{
+			name: "Marshaler",
+			obj:  DS1{F1: marshalerPoint{X: 1, Y: 2}},
+			str:  `{"f1":{"_t":"marshalerPoint","_v":[1,2]}}`,
+		},
+		{
+			name: "Marshaler pointer",
+			obj:  DS1{F1: &marshalerPoint{X: 1, Y: 2}},
+			str:  `{"f1":{"_t":"marshalerPoint","_v":[1,2]}}`,
+		},
+		{
+			name: "TextMarshaler",
+			obj:  DS1{F1: textMarshalerColor{R: 1, G: 2, B: 255}},
+			str:  `{"f1":{"_t":"textMarshalerColor","_v":"#0102ff"}}`,
+		},
+		{
+			name: "Marshaler map",
+			obj:  DS1{F1: marshalerObject{"n": 1}},
+			str:  `{"f1":{"_t":"marshalerObject","_v":{"n":1}}}`,
+		},
+		{
+			name:   "External",
+			layout: json.DiscriminatorLayoutExternal,
+			obj:    DS1{F1: marshalerPoint{X: 1, Y: 2}},
+			str:    `{"f1":{"marshalerPoint":[1,2]}}`,
+		},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			c := json.NewCodec(json.CodecOptions{
+				TypeFieldName:  "_t",
+				ValueFieldName: "_v",
+				TypeRegistry:   r,
+				Layout:         tc.layout,
+			})
+			data, err := c.Marshal(tc.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := string(data), tc.str; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			var obj DS1
+			if err := c.Unmarshal(data, &obj); err != nil {
+				t.Fatal(err)
+			}
+			exp := tc.obj.(DS1)
+			if p, ok := exp.F1.(*marshalerPoint); ok {
+				exp.F1 = *p
+			}
+			assertDeepEqual(t, obj, exp)
+		})
+	}
+
+	t.Run("Unmarshaler without type field", func(t *testing.T) {
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeRegistry:   r,
+		})
+		for _, str := range []string{
+			`{"f1":{"_t":"unmarshalerRaw","a":1,"b":[2]}}`,
+			`{"f1":{"a":1,"_t":"unmarshalerRaw","b":[2]}}`,
+			`{"f1":{"a":1,"b":[2],"_t":"unmarshalerRaw"}}`,
+		} {
+			var obj DS1
+			if err := c.Unmarshal([]byte(str), &obj); err != nil {
+				t.Fatal(err)
+			}
+			assertDeepEqual(t, obj, DS1{F1: unmarshalerRaw{Raw: `{"a":1,"b":[2]}`}})
+		}
+	})
+}
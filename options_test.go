@@ -0,0 +1,211 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+// optionsAlias marshals itself by marshaling an alias of its own type, as
+// many GoVmomi types do.
+type optionsAlias struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"`
+}
+
+func (x optionsAlias) MarshalJSONWithOptions(opts json.CodecOptions) ([]byte, error) {
+	type alias optionsAlias
+	return json.NewCodec(opts).Marshal(alias(x))
+}
+
+func (x *optionsAlias) UnmarshalJSONWithOptions(data []byte, opts json.CodecOptions) error {
+	type alias optionsAlias
+	return json.NewCodec(opts).Unmarshal(data, (*alias)(x))
+}
+
+// optionsPreferred implements both Marshaler and MarshalerWithOptions.
+type optionsPreferred struct {
+	optionsAlias
+}
+
+func (x optionsPreferred) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("MarshalJSON called")
+}
+
+func (x *optionsPreferred) UnmarshalJSON(data []byte) error {
+	return errors.New("UnmarshalJSON called")
+}
+
+type optionsAliasField struct {
+	A  optionsAlias  `json:"a"`
+	PA *optionsAlias `json:"pa"`
+}
+
+func TestMarshalerWithOptions(t *testing.T) {
+	opts := json.CodecOptions{
+		TypeFieldName:  "_t",
+		ValueFieldName: "_v",
+		TypeFn:         discriminatorToTypeFn,
+	}
+	c := json.NewCodec(opts)
+
+	for _, tc := range []struct {
+		name string
+		obj  interface{}
+		str  string
+	}{
+		{
+			name: "Value",
+			obj:  optionsAlias{Name: "a", Value: DS3{F1: "b"}},
+			str:  `{"name":"a","value":{"_t":"DS3","f1":"b"}}`,
+		},
+		{
+			name: "Pointer",
+			obj:  &optionsAlias{Name: "a", Value: uint8(1)},
+			str:  `{"name":"a","value":{"_t":"uint8","_v":1}}`,
+		},
+		{
+			name: "Field",
+			obj: optionsAliasField{
+				A:  optionsAlias{Value: []interface{}{DS3{F1: "b"}}},
+				PA: &optionsAlias{Value: int32(2)},
+			},
+			str: `{"a":{"name":"","value":{"_t":"[]interface {}","_v":[{"_t":"DS3","f1":"b"}]}},"pa":{"name":"","value":{"_t":"int32","_v":2}}}`,
+		},
+		{
+			name: "Preferred",
+			obj:  optionsPreferred{optionsAlias{Name: "a", Value: DS3{F1: "b"}}},
+			str:  `{"name":"a","value":{"_t":"DS3","f1":"b"}}`,
+		},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := c.Marshal(tc.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := string(data), tc.str; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+
+			var obj interface{}
+			switch tc.obj.(type) {
+			case optionsAlias:
+				obj = &optionsAlias{}
+			case *optionsAlias:
+				obj, tc.obj = &optionsAlias{}, *tc.obj.(*optionsAlias)
+			case optionsAliasField:
+				obj = &optionsAliasField{}
+			case optionsPreferred:
+				obj = &optionsPreferred{}
+			}
+			if err := c.Unmarshal(data, obj); err != nil {
+				t.Fatal(err)
+			}
+			switch obj := obj.(type) {
+			case *optionsAlias:
+				assertDeepEqual(t, *obj, tc.obj)
+			case *optionsAliasField:
+				assertDeepEqual(t, *obj, tc.obj)
+			case *optionsPreferred:
+				assertDeepEqual(t, *obj, tc.obj)
+			}
+		})
+	}
+
+	t.Run("Encode mode", func(t *testing.T) {
+		// The nested call does not encode the type name of the alias, which
+		// is neither the root value nor a type that may be decoded.
+		for _, tc := range []struct {
+			name string
+			mode json.DiscriminatorEncodeMode
+			str  string
+		}{
+			{
+				name: "Root value",
+				mode: json.DiscriminatorEncodeTypeNameRootValue,
+				str:  `{"_t":"optionsAliasField","a":{"name":"a","value":{"_t":"DS3","f1":"b"}},"pa":null}`,
+			},
+			{
+				name: "All objects",
+				mode: json.DiscriminatorEncodeTypeNameAllObjects,
+				str:  `{"_t":"optionsAliasField","a":{"name":"a","value":{"_t":"DS3","f1":"b"}},"pa":null}`,
+			},
+			{
+				name: "Root value and all objects",
+				mode: json.DiscriminatorEncodeTypeNameRootValue | json.DiscriminatorEncodeTypeNameAllObjects,
+				str:  `{"_t":"optionsAliasField","a":{"name":"a","value":{"_t":"DS3","f1":"b"}},"pa":null}`,
+			},
+		} {
+			tc := tc // capture the loop variable
+			t.Run(tc.name, func(t *testing.T) {
+				opts := opts
+				opts.EncodeMode = tc.mode
+				c := json.NewCodec(opts)
+				obj := optionsAliasField{A: optionsAlias{Name: "a", Value: DS3{F1: "b"}}}
+				data, err := c.Marshal(obj)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if a, e := string(data), tc.str; a != e {
+					t.Errorf("mismatch: e=%s, a=%s", e, a)
+				}
+				var obj2 optionsAliasField
+				if err := c.Unmarshal(data, &obj2); err != nil {
+					t.Fatal(err)
+				}
+				assertDeepEqual(t, obj2, obj)
+			})
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetDiscriminator("_t", "_v", 0)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(optionsAlias{Name: "<a>", Value: DS3{F1: "<b>"}}); err != nil {
+			t.Fatal(err)
+		}
+		if a, e := buf.String(), `{"name":"<a>","value":{"_t":"DS3","f1":"<b>"}}`+"\n"; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+
+		dec := json.NewDecoder(strings.NewReader(buf.String()))
+		dec.SetDiscriminator("_t", "_v", discriminatorToTypeFn)
+		var obj optionsAlias
+		if err := dec.Decode(&obj); err != nil {
+			t.Fatal(err)
+		}
+		assertDeepEqual(t, obj, optionsAlias{Name: "<a>", Value: DS3{F1: "<b>"}})
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		// The options of the decoder are given to the unmarshaler.
+		opts := opts
+		opts.DisallowUnknownFields = true
+		var obj optionsAlias
+		err := json.NewCodec(opts).Unmarshal([]byte(`{"name":"a","x":1}`), &obj)
+		if a, e := err, `json: unknown field "x"`; a == nil || a.Error() != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		_, err := c.Marshal(optionsAlias{Value: make(chan int)})
+		var me *json.MarshalerError
+		if !errors.As(err, &me) {
+			t.Fatalf("expected MarshalerError: a=%v", err)
+		}
+		if a, e := me.Error(), "json: error calling MarshalJSONWithOptions for type json_test.optionsAlias: json: unsupported value: invalid kind: chan"; a != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+		}
+	})
+}
@@ -0,0 +1,204 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	json "github.com/akutz/gdj"
+)
+
+func TestPeekDiscriminator(t *testing.T) {
+	newDecoder := func(str string, layout json.DiscriminatorLayout) *json.Decoder {
+		dec := json.NewDecoder(strings.NewReader(str))
+		dec.SetDiscriminator("_t", "_v", discriminatorToTypeFn)
+		dec.SetDiscriminatorLayout(layout)
+		return dec
+	}
+
+	for _, tc := range []struct {
+		name   string
+		str    string
+		layout json.DiscriminatorLayout
+		tn     string
+		t      reflect.Type
+		obj    interface{}
+	}{
+		{name: "Type field first", str: `{"_t":"DS3","f1":"a"}`, tn: "DS3", t: reflect.TypeOf(DS3{}), obj: DS3{F1: "a"}},
+		{name: "Type field last", str: `{"f1":{"a":[1,2]},"_t":"DS1"}`, tn: "DS1", t: reflect.TypeOf(DS1{}), obj: DS1{F1: map[string]interface{}{"a": []interface{}{1.0, 2.0}}}},
+		{name: "Primitive", str: `{"_t":"uint8","_v":1}`, tn: "uint8", t: reflect.TypeOf(uint8(0)), obj: uint8(1)},
+		{name: "Without type field", str: `{"f1":"a"}`, obj: map[string]interface{}{"f1": "a"}},
+		{name: "Array", str: `["DS3"]`, obj: []interface{}{"DS3"}},
+		{name: "String", str: `"DS3"`, obj: "DS3"},
+		{name: "External", str: `{"DS3":{"f1":"a"}}`, layout: json.DiscriminatorLayoutExternal, tn: "DS3", t: reflect.TypeOf(DS3{}), obj: DS3{F1: "a"}},
+		{name: "Adjacent", str: `{"_v":{"f1":"a"},"_t":"DS3"}`, layout: json.DiscriminatorLayoutAdjacent, tn: "DS3", t: reflect.TypeOf(DS3{}), obj: DS3{F1: "a"}},
+		{name: "Tuple", str: `["DS3",{"f1":"a"}]`, layout: json.DiscriminatorLayoutTuple, tn: "DS3", t: reflect.TypeOf(DS3{}), obj: DS3{F1: "a"}},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			dec := newDecoder(tc.str+" "+tc.str, tc.layout)
+			for i := 0; i < 2; i++ {
+				tn, typ, err := dec.PeekDiscriminator()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if tn != tc.tn || typ != tc.t {
+					t.Errorf("mismatch: e=%s %v, a=%s %v", tc.tn, tc.t, tn, typ)
+				}
+
+				// The value is not consumed.
+				var obj interface{}
+				if err := dec.Decode(&obj); err != nil {
+					t.Fatal(err)
+				}
+				assertDeepEqual(t, obj, tc.obj)
+			}
+			if dec.More() {
+				t.Error("expected the end of the input")
+			}
+		})
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		for _, tc := range []struct {
+			name   string
+			str    string
+			tn     string
+			reason string
+		}{
+			{name: "Unknown type", str: `{"f1":"a","_t":"DS9"}`, tn: "DS9", reason: "unknown discriminator type"},
+			{name: "Not string", str: `{"_t":1}`, reason: "discriminator type is not string"},
+			{name: "Empty", str: `{"_t":""}`, reason: "discriminator type is empty"},
+		} {
+			tc := tc // capture the loop variable
+			t.Run(tc.name, func(t *testing.T) {
+				dec := newDecoder("1\n"+tc.str, json.DiscriminatorLayoutInline)
+				if err := dec.Decode(new(int)); err != nil {
+					t.Fatal(err)
+				}
+				tn, _, err := dec.PeekDiscriminator()
+				var de *json.DiscriminatorError
+				if !errors.As(err, &de) {
+					t.Fatalf("expected DiscriminatorError: a=%v", err)
+				}
+				if tn != tc.tn || de.Reason != tc.reason || de.Line != 2 {
+					t.Errorf("mismatch: e=%s %q 2, a=%s %q %d", tc.tn, tc.reason, tn, de.Reason, de.Line)
+				}
+
+				// The decoder may be used after the error.
+				var obj map[string]interface{}
+				if err := dec.Decode(&obj); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	})
+
+	t.Run("Partial value", func(t *testing.T) {
+		// The value is not read past its type field, so the error returned
+		// by the reader after the type field is not returned.
+		errRead := errors.New("read past the type field")
+		for _, tc := range []struct {
+			name   string
+			str    string
+			layout json.DiscriminatorLayout
+		}{
+			{name: "Inline", str: `{"f1":{"a":[1,2]},"_t":"DS3",`},
+			{name: "External", str: `{"DS3":`, layout: json.DiscriminatorLayoutExternal},
+			{name: "Tuple", str: `["DS3",`, layout: json.DiscriminatorLayoutTuple},
+		} {
+			tc := tc // capture the loop variable
+			t.Run(tc.name, func(t *testing.T) {
+				dec := json.NewDecoder(io.MultiReader(
+					strings.NewReader(tc.str), iotest.ErrReader(errRead)))
+				dec.SetDiscriminator("_t", "_v", discriminatorToTypeFn)
+				dec.SetDiscriminatorLayout(tc.layout)
+				dec.UseTypedObjectStart()
+				tok, err := dec.Token()
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertDeepEqual(t, tok, json.TypedObjectStart{TypeName: "DS3", Type: reflect.TypeOf(DS3{})})
+
+				// The rest of the value is read when it is decoded.
+				var obj interface{}
+				if err := dec.Decode(&obj); err != errRead {
+					t.Errorf("expected error mismatch: e=%v, a=%v", errRead, err)
+				}
+			})
+		}
+	})
+
+	t.Run("Unknown type func", func(t *testing.T) {
+		dec := newDecoder(`{"_t":"DS9"}`, json.DiscriminatorLayoutInline)
+		dec.SetUnknownTypeFunc(json.NewUnknownDiscriminated)
+		tn, typ, err := dec.PeekDiscriminator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tn != "DS9" || typ != nil {
+			t.Errorf("mismatch: e=DS9 <nil>, a=%s %v", tn, typ)
+		}
+	})
+}
+
+func TestTypedObjectStart(t *testing.T) {
+	str := `{"items":[{"_t":"DS3","f1":"a"},{"f1":"b"},{"_t":"DS1","f1":1},{"_t":"DS9"},["DS3"]]}`
+	dec := json.NewDecoder(strings.NewReader(str))
+	dec.SetDiscriminator("_t", "_v", discriminatorToTypeFn)
+	dec.UseTypedObjectStart()
+
+	var (
+		toks []interface{}
+		objs []interface{}
+	)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			var de *json.DiscriminatorError
+			if errors.As(err, &de) {
+				toks = append(toks, de.TypeName)
+				continue
+			}
+			break
+		}
+		switch tok := tok.(type) {
+		case json.TypedObjectStart:
+			toks = append(toks, tok)
+
+			// Decode the object into the Go type it names.
+			v := reflect.New(tok.Type)
+			if err := dec.Decode(v.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			objs = append(objs, v.Elem().Interface())
+		default:
+			toks = append(toks, tok)
+		}
+	}
+
+	assertDeepEqual(t, toks, []interface{}{
+		json.Delim('{'),
+		"items",
+		json.Delim('['),
+		json.TypedObjectStart{TypeName: "DS3", Type: reflect.TypeOf(DS3{})},
+		json.Delim('{'), "f1", "b", json.Delim('}'),
+		json.TypedObjectStart{TypeName: "DS1", Type: reflect.TypeOf(DS1{})},
+		"DS9",
+		json.Delim('{'), "_t", "DS9", json.Delim('}'),
+		json.Delim('['), "DS3", json.Delim(']'),
+		json.Delim(']'),
+		json.Delim('}'),
+	})
+	assertDeepEqual(t, objs, []interface{}{
+		DS3{F1: "a"},
+		DS1{F1: 1.0},
+	})
+}
@@ -0,0 +1,149 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+func TestEncodeTypeNamePointers(t *testing.T) {
+	var (
+		u8     = uint8(1)
+		ds3Ptr = &DS3{F1: "b"}
+	)
+
+	for _, tc := range []struct {
+		name   string
+		layout json.DiscriminatorLayout
+		obj    DS1
+		str    string
+	}{
+		{name: "Struct", obj: DS1{F1: &DS3{F1: "a"}}, str: `{"f1":{"_t":"*DS3","_v":{"f1":"a"}}}`},
+		{name: "Value", obj: DS1{F1: DS3{F1: "a"}}, str: `{"f1":{"_t":"DS3","f1":"a"}}`},
+		{name: "Primitive", obj: DS1{F1: &u8}, str: `{"f1":{"_t":"*uint8","_v":1}}`},
+		{name: "Map", obj: DS1{F1: &map[string]int{"a": 1}}, str: `{"f1":{"_t":"*map[string]int","_v":{"a":1}}}`},
+		{name: "Pointer to pointer", obj: DS1{F1: &ds3Ptr}, str: `{"f1":{"_t":"**DS3","_v":{"f1":"b"}}}`},
+		{name: "Typed nil", obj: DS1{F1: (*DS3)(nil)}, str: `{"f1":{"_t":"*DS3","_v":null}}`},
+		{name: "Slice", obj: DS1{F1: []interface{}{&DS3{F1: "a"}, DS3{F1: "b"}}}, str: `{"f1":{"_t":"[]interface {}","_v":[{"_t":"*DS3","_v":{"f1":"a"}},{"_t":"DS3","f1":"b"}]}}`},
+		{name: "Nested", obj: DS1{F1: &DS1{F1: &DS3{F1: "a"}}}, str: `{"f1":{"_t":"*DS1","_v":{"f1":{"_t":"*DS3","_v":{"f1":"a"}}}}}`},
+		{name: "External", layout: json.DiscriminatorLayoutExternal, obj: DS1{F1: &DS3{F1: "a"}}, str: `{"f1":{"*DS3":{"f1":"a"}}}`},
+		{name: "Adjacent", layout: json.DiscriminatorLayoutAdjacent, obj: DS1{F1: &DS3{F1: "a"}}, str: `{"f1":{"_t":"*DS3","_v":{"f1":"a"}}}`},
+		{name: "Tuple", layout: json.DiscriminatorLayoutTuple, obj: DS1{F1: &DS3{F1: "a"}}, str: `{"f1":["*DS3",{"f1":"a"}]}`},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			c := json.NewCodec(json.CodecOptions{
+				TypeFieldName:  "_t",
+				ValueFieldName: "_v",
+				EncodeMode:     json.DiscriminatorEncodeTypeNamePointers,
+				TypeFn:         discriminatorToTypeFn,
+				Layout:         tc.layout,
+			})
+			data, err := c.Marshal(tc.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := string(data), tc.str; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			var obj DS1
+			if err := c.Unmarshal(data, &obj); err != nil {
+				t.Fatal(err)
+			}
+			assertDeepEqual(t, obj, tc.obj)
+		})
+	}
+
+	t.Run("Without mode", func(t *testing.T) {
+		// The pointer is encoded as the value to which it points, so it is
+		// decoded as a value.
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeFn:         discriminatorToTypeFn,
+		})
+		data, err := c.Marshal(DS1{F1: &DS3{F1: "a"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, e := string(data), `{"f1":{"_t":"DS3","f1":"a"}}`; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+		var obj DS1
+		if err := c.Unmarshal(data, &obj); err != nil {
+			t.Fatal(err)
+		}
+		assertDeepEqual(t, obj, DS1{F1: DS3{F1: "a"}})
+	})
+
+	t.Run("Root value", func(t *testing.T) {
+		data, err := json.MarshalWithDiscriminator(&DS3{F1: "a"}, "_t", "_v",
+			json.DiscriminatorEncodeTypeNameRootValue|json.DiscriminatorEncodeTypeNamePointers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, e := string(data), `{"_t":"*DS3","_v":{"f1":"a"}}`; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+		var obj interface{}
+		if err := json.UnmarshalWithDiscriminator(data, &obj, "_t", "_v", discriminatorToTypeFn); err != nil {
+			t.Fatal(err)
+		}
+		assertDeepEqual(t, obj, &DS3{F1: "a"})
+	})
+
+	t.Run("Interface", func(t *testing.T) {
+		c := json.NewCodec(json.CodecOptions{
+			EncodeMode:   json.DiscriminatorEncodeTypeNamePointers,
+			TypeRegistry: newAnimalRegistryForTests(t),
+		})
+		for _, tc := range []struct {
+			obj animalOwner
+			str string
+		}{
+			{obj: animalOwner{Pet: animalDog{Name: "a"}}, str: `{"pet":{"kind":"dog","name":"a"}}`},
+			{obj: animalOwner{Pet: &animalDog{Name: "a"}}, str: `{"pet":{"kind":"*dog","value":{"name":"a"}}}`},
+			{obj: animalOwner{Pet: &animalCat{Name: "a"}}, str: `{"pet":{"kind":"*cat","value":{"name":"a"}}}`},
+		} {
+			data, err := c.Marshal(tc.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := string(data), tc.str; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			var obj animalOwner
+			if err := c.Unmarshal(data, &obj); err != nil {
+				t.Fatal(err)
+			}
+			assertDeepEqual(t, obj, tc.obj)
+		}
+	})
+
+	t.Run("Unknown type", func(t *testing.T) {
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			EncodeMode:     json.DiscriminatorEncodeTypeNamePointers,
+			TypeFn:         discriminatorToTypeFn,
+			UnknownTypeFn:  json.NewUnknownDiscriminated,
+		})
+		str := `{"f1":{"_t":"DS9","a":1}}`
+		var obj DS1
+		if err := c.Unmarshal([]byte(str), &obj); err != nil {
+			t.Fatal(err)
+		}
+		u := obj.F1.(json.UnknownDiscriminated)
+		data, err := c.Marshal(DS1{F1: &u})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, e := string(data), str; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+	})
+}
@@ -0,0 +1,192 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+func TestDecodePolicy(t *testing.T) {
+	newCodec := func(p json.DecodePolicy) *json.Codec {
+		return json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeFn:         discriminatorToTypeFn,
+			DecodePolicy:   p,
+		})
+	}
+
+	for _, tc := range []struct {
+		name   string
+		policy json.DecodePolicy
+		str    string
+		limit  string
+	}{
+		{
+			name:   "Array length",
+			policy: json.DecodePolicy{MaxArrayLen: 4},
+			str:    `{"f1":{"_t":"[999999999]int","_v":[]}}`,
+			limit:  "MaxArrayLen",
+		},
+		{
+			name:   "Array length within limit",
+			policy: json.DecodePolicy{MaxArrayLen: 4},
+			str:    `{"f1":{"_t":"[4]int","_v":[1,2,3,4]}}`,
+		},
+		{
+			name:   "Nested array length",
+			policy: json.DecodePolicy{MaxArrayLen: 1000},
+			str:    `{"f1":{"_t":"[1000][1000][1000][1000]int8","_v":null}}`,
+			limit:  "MaxArrayLen",
+		},
+		{
+			name:   "Nested array length within limit",
+			policy: json.DecodePolicy{MaxArrayLen: 8},
+			str:    `{"f1":{"_t":"[4][2]int","_v":[[1,2],[3,4],[5,6],[7,8]]}}`,
+		},
+		{
+			name:   "Type size",
+			policy: json.DecodePolicy{MaxTypeSize: 1 << 20},
+			str:    `{"f1":{"_t":"*[1024][1024][1024]int8","_v":null}}`,
+			limit:  "MaxTypeSize",
+		},
+		{
+			name:   "Struct type size",
+			policy: json.DecodePolicy{MaxTypeSize: 16},
+			str:    `{"f1":{"_t":"struct { A [2]int64; B [2]int64 }"}}`,
+			limit:  "MaxTypeSize",
+		},
+		{
+			name:   "Type size within limit",
+			policy: json.DecodePolicy{MaxTypeSize: 16},
+			str:    `{"f1":{"_t":"struct { A [2]int64 }","A":[1,2]}}`,
+		},
+		{
+			name:   "Slice",
+			policy: json.DecodePolicy{DisallowCompositeTypeNames: true},
+			str:    `{"f1":{"_t":"[]int","_v":[1]}}`,
+			limit:  "DisallowCompositeTypeNames",
+		},
+		{
+			name:   "Map",
+			policy: json.DecodePolicy{DisallowCompositeTypeNames: true},
+			str:    `{"f1":{"_t":"map[string]int","a":1}}`,
+			limit:  "DisallowCompositeTypeNames",
+		},
+		{
+			name:   "Pointer",
+			policy: json.DecodePolicy{DisallowCompositeTypeNames: true},
+			str:    `{"f1":{"_t":"*DS3","f1":"a"}}`,
+			limit:  "DisallowCompositeTypeNames",
+		},
+		{
+			name:   "Named type",
+			policy: json.DecodePolicy{DisallowCompositeTypeNames: true},
+			str:    `{"f1":{"_t":"DS3","f1":"a"}}`,
+		},
+		{
+			name:   "Depth",
+			policy: json.DecodePolicy{MaxDepth: 3},
+			str:    `{"f1":[[{}]]}`,
+			limit:  "MaxDepth",
+		},
+		{
+			name:   "Depth within limit",
+			policy: json.DecodePolicy{MaxDepth: 3},
+			str:    `{"f1":[[1]]}`,
+		},
+		{
+			name:   "Input bytes",
+			policy: json.DecodePolicy{MaxInputBytes: 10},
+			str:    `{"f1":"abcdef"}`,
+			limit:  "MaxInputBytes",
+		},
+		{
+			name:   "Discriminated values",
+			policy: json.DecodePolicy{MaxDiscriminatedValues: 2},
+			str:    `{"f1":{"_t":"DS1","f1":{"_t":"DS1","f1":{"_t":"DS3"}}}}`,
+			limit:  "MaxDiscriminatedValues",
+		},
+		{
+			name:   "Discriminated values after rescan",
+			policy: json.DecodePolicy{MaxDiscriminatedValues: 2},
+			str:    `{"f1":{"f1":{"_t":"DS1","f1":{"_t":"DS3"}},"_t":"DS1"}}`,
+			limit:  "MaxDiscriminatedValues",
+		},
+		{
+			name:   "Discriminated values within limit",
+			policy: json.DecodePolicy{MaxDiscriminatedValues: 3},
+			str:    `{"f1":{"f1":{"_t":"DS1","f1":{"_t":"DS3"}},"_t":"DS1"}}`,
+		},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			for _, decode := range []func(*DS1) error{
+				func(obj *DS1) error {
+					return newCodec(tc.policy).Unmarshal([]byte(tc.str), obj)
+				},
+				func(obj *DS1) error {
+					return newCodec(tc.policy).NewDecoder(strings.NewReader(tc.str)).Decode(obj)
+				},
+			} {
+				err := decode(&DS1{})
+				if tc.limit == "" {
+					if err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				var pe *json.PolicyError
+				if !errors.As(err, &pe) {
+					t.Fatalf("expected PolicyError: a=%v", err)
+				}
+				if pe.Limit != tc.limit {
+					t.Errorf("limit mismatch: e=%s, a=%s", tc.limit, pe.Limit)
+				}
+			}
+		})
+	}
+
+	t.Run("Decoder input bytes", func(t *testing.T) {
+		dec := json.NewDecoder(strings.NewReader(`1 2 3 4`))
+		dec.SetDecodePolicy(json.DecodePolicy{MaxInputBytes: 4})
+		var objs []int
+		var err error
+		for err == nil {
+			var obj int
+			if err = dec.Decode(&obj); err == nil {
+				objs = append(objs, obj)
+			}
+		}
+		assertDeepEqual(t, objs, []int{1, 2})
+		var pe *json.PolicyError
+		if !errors.As(err, &pe) || pe.Limit != "MaxInputBytes" {
+			t.Errorf("expected PolicyError: a=%v", err)
+		}
+	})
+
+	t.Run("Decoder token depth", func(t *testing.T) {
+		dec := json.NewDecoder(strings.NewReader(`[[[1],[{}]]]`))
+		dec.SetDecodePolicy(json.DecodePolicy{MaxDepth: 3})
+		for i := 0; i < 2; i++ {
+			if _, err := dec.Token(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var obj interface{}
+		if err := dec.Decode(&obj); err != nil {
+			t.Fatal(err)
+		}
+		err := dec.Decode(&obj)
+		var pe *json.PolicyError
+		if !errors.As(err, &pe) || pe.Limit != "MaxDepth" {
+			t.Errorf("expected PolicyError: a=%v", err)
+		}
+	})
+}
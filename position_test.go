@@ -0,0 +1,205 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	json "github.com/akutz/gdj"
+)
+
+// positionWrapped returns a wrapped UnmarshalTypeError from UnmarshalJSON,
+// the offset of which counts from the start of the data it is given.
+type positionWrapped struct{}
+
+func (positionWrapped) UnmarshalJSON(data []byte) error {
+	return fmt.Errorf("positionWrapped: %w", &json.UnmarshalTypeError{
+		Value:  "number",
+		Type:   reflect.TypeOf(positionWrapped{}),
+		Offset: int64(len(data)),
+	})
+}
+
+// positionNested returns the error of a nested call to Unmarshal from
+// UnmarshalJSON.
+type positionNested struct {
+	F1 string
+}
+
+func (x *positionNested) UnmarshalJSON(data []byte) error {
+	type alias positionNested
+	if err := json.Unmarshal(data, (*alias)(x)); err != nil {
+		return fmt.Errorf("positionNested: %w", err)
+	}
+	return nil
+}
+
+type positionOwner struct {
+	A positionWrapped `json:"a"`
+	B positionNested  `json:"b"`
+}
+
+// errorPosition returns the line, column, and excerpt of err.
+func errorPosition(t *testing.T, err error) (int, int, string) {
+	t.Helper()
+	var (
+		se  *json.SyntaxError
+		ute *json.UnmarshalTypeError
+		de  *json.DiscriminatorError
+	)
+	switch {
+	case errors.As(err, &se):
+		return se.Line, se.Column, se.Excerpt
+	case errors.As(err, &ute):
+		return ute.Line, ute.Column, ute.Excerpt
+	case errors.As(err, &de):
+		return de.Line, de.Column, de.Excerpt
+	}
+	t.Fatalf("unexpected error: %v", err)
+	return 0, 0, ""
+}
+
+func TestErrorPosition(t *testing.T) {
+	longLine := `{"a":"` + strings.Repeat("b", 100) + `","c":tru}`
+
+	for _, tc := range []struct {
+		name    string
+		str     string
+		obj     interface{}
+		line    int
+		column  int
+		excerpt string
+	}{
+		{
+			name:    "Syntax error",
+			str:     "{\n  \"a\": 1,\n  \"b\": tru\n}",
+			obj:     new(interface{}),
+			line:    3,
+			column:  11,
+			excerpt: "  \"b\": tru\n          ^",
+		},
+		{
+			name:    "Unexpected end",
+			str:     "[\n  1,\n",
+			obj:     new(interface{}),
+			line:    2,
+			column:  5,
+			excerpt: "  1,\n    ^",
+		},
+		{
+			name:    "Type error",
+			str:     "{\n  \"f1\": 1\n}",
+			obj:     &DS3{},
+			line:    2,
+			column:  9,
+			excerpt: "  \"f1\": 1\n        ^",
+		},
+		{
+			name:    "Tabs and CRLF",
+			str:     "{\r\n\t\"f1\":\t1\r\n}",
+			obj:     &DS3{},
+			line:    2,
+			column:  8,
+			excerpt: "\t\"f1\":\t1\n\t     \t^",
+		},
+		{
+			name:    "Discriminator error",
+			str:     "{\n  \"f1\": {\"_t\": \"DS9\"}\n}",
+			obj:     &DS1{},
+			line:    2,
+			column:  9,
+			excerpt: "  \"f1\": {\"_t\": \"DS9\"}\n        ^",
+		},
+		{
+			name:    "Wrapped error",
+			str:     "\n  1",
+			obj:     &positionWrapped{},
+			line:    2,
+			column:  3,
+			excerpt: "  1\n  ^",
+		},
+		{
+			name:    "Wrapped error in field",
+			str:     "{\n  \"a\": 1\n}",
+			obj:     &positionOwner{},
+			line:    2,
+			column:  8,
+			excerpt: "  \"a\": 1\n       ^",
+		},
+		{
+			name:    "Nested Unmarshal error",
+			str:     "{\n  \"b\": {\"F1\": 1}\n}",
+			obj:     &positionOwner{},
+			line:    2,
+			column:  15,
+			excerpt: "  \"b\": {\"F1\": 1}\n              ^",
+		},
+		{
+			name:    "Long line",
+			str:     longLine,
+			obj:     new(interface{}),
+			line:    1,
+			column:  len(longLine),
+			excerpt: "..." + longLine[len(longLine)-72:] + "\n" + strings.Repeat(" ", 3+71) + "^",
+		},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			err := json.UnmarshalWithDiscriminator(
+				[]byte(tc.str), tc.obj, "_t", "_v", discriminatorToTypeFn)
+			line, column, excerpt := errorPosition(t, err)
+			if line != tc.line || column != tc.column {
+				t.Errorf("position mismatch: e=%d:%d, a=%d:%d", tc.line, tc.column, line, column)
+			}
+			if excerpt != tc.excerpt {
+				t.Errorf("excerpt mismatch:\ne=%q\na=%q", tc.excerpt, excerpt)
+			}
+		})
+	}
+
+	t.Run("Decoder", func(t *testing.T) {
+		// The values are read one byte at a time so the lines are counted
+		// across the data discarded from the decoder's buffer.
+		str := strings.Repeat("{\"f1\": \"a\"}\n", 100) + "{\n  \"f1\": 1\n}\n"
+		dec := json.NewDecoder(iotest.OneByteReader(strings.NewReader(str)))
+		var err error
+		for err == nil {
+			err = dec.Decode(&DS3{})
+		}
+		line, column, excerpt := errorPosition(t, err)
+		if line != 102 || column != 9 {
+			t.Errorf("position mismatch: e=102:9, a=%d:%d", line, column)
+		}
+		if e := "  \"f1\": 1\n        ^"; excerpt != e {
+			t.Errorf("excerpt mismatch:\ne=%q\na=%q", e, excerpt)
+		}
+		if err := dec.Decode(&DS3{}); err != io.EOF {
+			t.Errorf("expected EOF: a=%v", err)
+		}
+	})
+
+	t.Run("Decoder syntax error", func(t *testing.T) {
+		str := strings.Repeat("1\n", 300) + "[1,\n  2 3]"
+		dec := json.NewDecoder(strings.NewReader(str))
+		var err error
+		for err == nil {
+			var obj interface{}
+			err = dec.Decode(&obj)
+		}
+		line, column, excerpt := errorPosition(t, err)
+		if line != 302 || column != 5 {
+			t.Errorf("position mismatch: e=302:5, a=%d:%d", line, column)
+		}
+		if e := "  2 3]\n    ^"; excerpt != e {
+			t.Errorf("excerpt mismatch:\ne=%q\na=%q", e, excerpt)
+		}
+	})
+}
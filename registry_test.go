@@ -0,0 +1,155 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+func newTypeRegistryForTests(t *testing.T) *json.TypeRegistry {
+	r := json.NewTypeRegistry()
+	for _, tc := range []struct {
+		obj     interface{}
+		name    string
+		aliases []string
+	}{
+		{obj: DS3{}, name: "ds3", aliases: []string{"DS3"}},
+		{obj: DS4{}, name: "ds4"},
+		{obj: uint8Noop(0), name: ""},
+	} {
+		if err := r.Register(reflect.TypeOf(tc.obj), tc.name, tc.aliases...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func TestTypeRegistry(t *testing.T) {
+	t.Run("Lookup", func(t *testing.T) {
+		r := newTypeRegistryForTests(t)
+		for _, tc := range []struct {
+			name string
+			typ  reflect.Type
+		}{
+			{name: "ds3", typ: reflect.TypeOf(DS3{})},
+			{name: "DS3", typ: reflect.TypeOf(DS3{})},
+			{name: "ds4", typ: reflect.TypeOf(DS4{})},
+			{name: "uint8Noop", typ: reflect.TypeOf(uint8Noop(0))},
+			{name: "uint8", typ: reflect.TypeOf(uint8(0))},
+			{name: "interface {}", typ: reflect.TypeOf((*interface{})(nil)).Elem()},
+		} {
+			if a, ok := r.TypeOf(tc.name); !ok || a != tc.typ {
+				t.Errorf("TypeOf(%q) mismatch: e=%v, a=%v", tc.name, tc.typ, a)
+			}
+		}
+		if a, ok := r.NameOf(reflect.TypeOf(DS3{})); !ok || a != "ds3" {
+			t.Errorf("NameOf mismatch: e=ds3, a=%s", a)
+		}
+		if _, ok := r.TypeOf("DS5"); ok {
+			t.Error("unexpected type for DS5")
+		}
+		if _, ok := r.NameOf(reflect.TypeOf(DS5{})); ok {
+			t.Error("unexpected name for DS5")
+		}
+	})
+
+	t.Run("Parents", func(t *testing.T) {
+		p1 := newTypeRegistryForTests(t)
+		p2 := json.NewTypeRegistry()
+		if err := p2.Register(reflect.TypeOf(DS5{}), "ds5"); err != nil {
+			t.Fatal(err)
+		}
+		r := json.NewTypeRegistry(p1, p2)
+		if a, ok := r.TypeOf("ds3"); !ok || a != reflect.TypeOf(DS3{}) {
+			t.Errorf("TypeOf(ds3) mismatch: a=%v", a)
+		}
+		if a, ok := r.NameOf(reflect.TypeOf(DS5{})); !ok || a != "ds5" {
+			t.Errorf("NameOf mismatch: e=ds5, a=%s", a)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		r := newTypeRegistryForTests(t)
+		for _, tc := range []struct {
+			typ  reflect.Type
+			name string
+			err  string
+		}{
+			{typ: nil, name: "nil", err: `json: cannot register nil type`},
+			{typ: reflect.TypeOf(DS5{}), name: "uint8", err: `json: type name "uint8" is reserved for built-in type uint8`},
+			{typ: reflect.TypeOf(DS5{}), name: "ds3", err: `json: type name "ds3" already registered to json_test.DS3`},
+			{typ: reflect.TypeOf(DS3{}), name: "ds5", err: `json: type json_test.DS3 already registered as "ds3"`},
+		} {
+			err := r.Register(tc.typ, tc.name)
+			if a, e := err, tc.err; a == nil || a.Error() != e {
+				t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+			}
+		}
+		if err := r.Register(reflect.TypeOf(DS3{}), "ds3", "DS3"); err != nil {
+			t.Errorf("unexpected error re-registering type: %v", err)
+		}
+	})
+
+	t.Run("Encode and decode", func(t *testing.T) {
+		r := newTypeRegistryForTests(t)
+		for _, tc := range []struct {
+			obj  interface{}
+			str  string
+			mode json.DiscriminatorEncodeMode
+		}{
+			{obj: DS1{F1: DS3{F1: "hello"}}, str: `{"f1":{"_t":"ds3","f1":"hello"}}`},
+			{obj: DS1{F1: []DS3{{F1: "hello"}}}, str: `{"f1":{"_t":"[]ds3","_v":[{"f1":"hello"}]}}`},
+			{obj: DS1{F1: map[string]*DS4{"a": {F1: "hello", F2: uint8Noop(1)}}}, str: `{"f1":{"_t":"map[string]*ds4","a":{"f1":"hello","f2":{"_t":"uint8Noop","_v":1}}}}`},
+			{obj: DS1{F1: DS3{F1: "hello"}}, str: `{"f1":{"_t":"ds3","f1":"hello"}}`, mode: json.DiscriminatorEncodeTypeNameRegisteredOnly},
+			{obj: DS1{F1: uint8(1)}, str: `{"f1":{"_t":"uint8","_v":1}}`, mode: json.DiscriminatorEncodeTypeNameRegisteredOnly},
+		} {
+			var w bytes.Buffer
+			enc := json.NewEncoder(&w)
+			enc.SetDiscriminator("_t", "_v", tc.mode)
+			enc.SetTypeRegistry(r)
+			if err := enc.Encode(tc.obj); err != nil {
+				t.Fatal(err)
+			}
+			if a, e := w.String(), tc.str+"\n"; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			dec := json.NewDecoder(&w)
+			dec.SetDiscriminator("_t", "_v", nil)
+			dec.SetTypeRegistry(r)
+			obj := reflect.New(reflect.TypeOf(tc.obj))
+			if err := dec.Decode(obj.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			assertEqual(t, obj.Elem().Interface(), tc.obj)
+		}
+	})
+
+	t.Run("Registered only", func(t *testing.T) {
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			EncodeMode:     json.DiscriminatorEncodeTypeNameRegisteredOnly,
+			TypeRegistry:   newTypeRegistryForTests(t),
+		})
+		_, err := c.Marshal(DS1{F1: DS5{F1: "hello"}})
+		if a, e := err, `json: discriminator type not registered: json_test.DS5`; a == nil || a.Error() != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+		}
+	})
+
+	t.Run("TypeFunc", func(t *testing.T) {
+		var obj DS1
+		if err := json.UnmarshalWithDiscriminator(
+			[]byte(`{"f1":{"_t":"DS3","f1":"hello"}}`), &obj,
+			"_t", "_v", newTypeRegistryForTests(t).TypeFunc()); err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, obj, DS1{F1: DS3{F1: "hello"}})
+	})
+}
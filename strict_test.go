@@ -0,0 +1,165 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+type animalPuppy struct {
+	animalDog
+	Age int `json:"age"`
+}
+
+type animalKennel struct {
+	Dog animalDog `json:"dog"`
+	Pet animal    `json:"pet,omitempty"`
+}
+
+func TestDisallowTypeNameMismatch(t *testing.T) {
+	types := newAnimalRegistryForTests(t)
+	for _, tc := range []struct {
+		t reflect.Type
+		n string
+	}{
+		{t: reflect.TypeOf(animalDog{}), n: "dog"},
+		{t: reflect.TypeOf(animalCat{}), n: "cat"},
+		{t: reflect.TypeOf(animalPuppy{}), n: "puppy"},
+	} {
+		if err := types.Register(tc.t, tc.n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newCodec := func(strict bool) *json.Codec {
+		return json.NewCodec(json.CodecOptions{
+			TypeFieldName:            "_t",
+			ValueFieldName:           "_v",
+			TypeRegistry:             types,
+			DisallowUnknownFields:    true,
+			DisallowTypeNameMismatch: strict,
+		})
+	}
+
+	t.Run("Unknown fields", func(t *testing.T) {
+		var obj animalDog
+		if err := newCodec(false).Unmarshal([]byte(`{"name":"a","_t":"cat"}`), &obj); err != nil {
+			t.Fatal(err)
+		}
+		assertDeepEqual(t, obj, animalDog{Name: "a"})
+
+		err := newCodec(false).Unmarshal([]byte(`{"name":"a","_x":"cat"}`), &obj)
+		if a, e := err, `json: unknown field "_x"`; a == nil || a.Error() != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+		}
+	})
+
+	t.Run("Decoder", func(t *testing.T) {
+		dec := json.NewDecoder(strings.NewReader(`{"_t":"cat","name":"a"}`))
+		dec.SetDiscriminator("_t", "_v", nil)
+		dec.SetTypeRegistry(types)
+		dec.DisallowUnknownFields()
+		dec.DisallowTypeNameMismatch()
+		var obj animalDog
+		err := dec.Decode(&obj)
+		if a, e := err, `json: discriminator type cat does not match json_test.animalDog`; a == nil || a.Error() != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+		}
+	})
+
+	for _, tc := range []struct {
+		name string
+		str  string
+		obj  interface{}
+		exp  interface{}
+		err  json.DiscriminatorError
+	}{
+		{
+			name: "Same type",
+			str:  `{"_t":"dog","name":"a"}`,
+			obj:  &animalDog{},
+			exp:  &animalDog{Name: "a"},
+		},
+		{
+			name: "Embedding type",
+			str:  `{"name":"a","_t":"puppy"}`,
+			obj:  &animalDog{},
+			exp:  &animalDog{Name: "a"},
+		},
+		{
+			name: "Without type field",
+			str:  `{"name":"a"}`,
+			obj:  &animalDog{},
+			exp:  &animalDog{Name: "a"},
+		},
+		{
+			name: "Interface",
+			str:  `{"dog":{"_t":"dog","name":"a"},"pet":{"kind":"cat","name":"b"}}`,
+			obj:  &animalKennel{},
+			exp:  &animalKennel{Dog: animalDog{Name: "a"}, Pet: &animalCat{Name: "b"}},
+		},
+		{
+			name: "Other type",
+			str:  `{"_t":"cat","name":"a"}`,
+			obj:  &animalDog{},
+			err:  json.DiscriminatorError{TypeName: "cat", Reason: "discriminator type does not match", Offset: 6, Type: reflect.TypeOf(animalDog{})},
+		},
+		{
+			name: "Embedded type",
+			str:  `{"_t":"dog","name":"a"}`,
+			obj:  &animalPuppy{},
+			err:  json.DiscriminatorError{TypeName: "dog", Reason: "discriminator type does not match", Offset: 6, Type: reflect.TypeOf(animalPuppy{})},
+		},
+		{
+			name: "Nested type",
+			str:  `{"dog":{"name":"a","_t":"cat"}}`,
+			obj:  &animalKennel{},
+			err:  json.DiscriminatorError{TypeName: "cat", Reason: "discriminator type does not match", Offset: 24, Path: "/dog", Type: reflect.TypeOf(animalDog{})},
+		},
+		{
+			name: "Unknown type",
+			str:  `{"_t":"wolf","name":"a"}`,
+			obj:  &animalDog{},
+			err:  json.DiscriminatorError{TypeName: "wolf", Reason: "unknown discriminator type", Offset: 6, Type: reflect.TypeOf(animalDog{})},
+		},
+		{
+			name: "Map",
+			str:  `{"_t":"dog","name":"a"}`,
+			obj:  &map[string]string{},
+			err:  json.DiscriminatorError{TypeName: "dog", Reason: "discriminator type does not match", Offset: 6, Type: reflect.TypeOf(map[string]string{})},
+		},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			err := newCodec(true).Unmarshal([]byte(tc.str), tc.obj)
+			if tc.exp != nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertDeepEqual(t, tc.obj, tc.exp)
+				return
+			}
+			var de *json.DiscriminatorError
+			if !errors.As(err, &de) {
+				t.Fatalf("expected DiscriminatorError: a=%v", err)
+			}
+			a, e := *de, tc.err
+			if a.TypeName != e.TypeName || a.Reason != e.Reason ||
+				a.Offset != e.Offset || a.Path != e.Path || a.Type != e.Type {
+				t.Errorf("mismatch: e=%+v, a=%+v", e, a)
+			}
+
+			// The type name is not checked unless the option is set.
+			if err := newCodec(false).Unmarshal([]byte(tc.str), tc.obj); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"reflect"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+func TestTypedNilPointer(t *testing.T) {
+	var (
+		nilDS3    *DS3
+		nilUint8  *uint8
+		nilSlice  *[]int
+		nilMap    map[string]int
+		nilDS3Ptr = &nilDS3
+	)
+
+	for _, tc := range []struct {
+		name   string
+		layout json.DiscriminatorLayout
+		obj    DS1
+		str    string
+		e      DS1 // the decoded value, if not obj
+	}{
+		{name: "Struct", obj: DS1{F1: nilDS3}, str: `{"f1":{"_t":"*DS3","_v":null}}`},
+		{name: "Primitive", obj: DS1{F1: nilUint8}, str: `{"f1":{"_t":"*uint8","_v":null}}`},
+		{name: "Slice", obj: DS1{F1: nilSlice}, str: `{"f1":{"_t":"*[]int","_v":null}}`},
+		{name: "Pointer to nil pointer", obj: DS1{F1: nilDS3Ptr}, str: `{"f1":{"_t":"*DS3","_v":null}}`, e: DS1{F1: nilDS3}},
+		{name: "Nested", obj: DS1{F1: []interface{}{nilDS3, DS3{F1: "a"}}}, str: `{"f1":{"_t":"[]interface {}","_v":[{"_t":"*DS3","_v":null},{"_t":"DS3","f1":"a"}]}}`},
+		{name: "Nil interface", obj: DS1{}, str: `{"f1":null}`},
+		{name: "Nil map", obj: DS1{F1: nilMap}, str: `{"f1":{"_t":"map[string]int","_v":null}}`},
+		{name: "Empty map", obj: DS1{F1: map[string]int{}}, str: `{"f1":{"_t":"map[string]int"}}`},
+		{name: "Map with value field key", obj: DS1{F1: map[string]*int{"_v": nil}}, str: `{"f1":{"_t":"map[string]*int","__v":null}}`},
+		{name: "Nil map external", layout: json.DiscriminatorLayoutExternal, obj: DS1{F1: nilMap}, str: `{"f1":{"map[string]int":null}}`},
+		{name: "External", layout: json.DiscriminatorLayoutExternal, obj: DS1{F1: nilDS3}, str: `{"f1":{"*DS3":null}}`},
+		{name: "Adjacent", layout: json.DiscriminatorLayoutAdjacent, obj: DS1{F1: nilDS3}, str: `{"f1":{"_t":"*DS3","_v":null}}`},
+		{name: "Tuple", layout: json.DiscriminatorLayoutTuple, obj: DS1{F1: nilDS3}, str: `{"f1":["*DS3",null]}`},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			c := json.NewCodec(json.CodecOptions{
+				TypeFieldName:  "_t",
+				ValueFieldName: "_v",
+				TypeFn:         discriminatorToTypeFn,
+				Layout:         tc.layout,
+			})
+			data, err := c.Marshal(tc.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := string(data), tc.str; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			var obj DS1
+			if err := c.Unmarshal(data, &obj); err != nil {
+				t.Fatal(err)
+			}
+			e := tc.obj
+			if tc.e.F1 != nil {
+				e = tc.e
+			}
+			assertDeepEqual(t, obj, e)
+		})
+	}
+
+	t.Run("Value field first", func(t *testing.T) {
+		var obj DS1
+		if err := json.UnmarshalWithDiscriminator(
+			[]byte(`{"f1":{"_v":null,"_t":"*DS3"}}`), &obj,
+			"_t", "_v", discriminatorToTypeFn); err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := obj.F1.(*DS3); !ok || v != nil {
+			t.Errorf("expected typed nil *DS3: a=%#v", obj.F1)
+		}
+	})
+
+	t.Run("Nil map before struct", func(t *testing.T) {
+		type owner struct {
+			Y interface{}
+			Z struct{ Name string }
+		}
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeFn:         discriminatorToTypeFn,
+		})
+		obj := owner{Y: nilMap}
+		data, err := c.Marshal(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, e := string(data), `{"Y":{"_t":"map[string]int","_v":null},"Z":{"Name":""}}`; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+		var obj2 owner
+		if err := c.Unmarshal(data, &obj2); err != nil {
+			t.Fatal(err)
+		}
+		assertDeepEqual(t, obj2, obj)
+	})
+
+	t.Run("Interface", func(t *testing.T) {
+		var nilCat *animalCat
+		for _, tc := range []struct {
+			name    string
+			allowed []reflect.Type
+			err     string
+		}{
+			{name: "Allowed", allowed: []reflect.Type{reflect.TypeOf(nilCat)}},
+			{name: "Any"},
+			{name: "Not allowed", allowed: []reflect.Type{reflect.TypeOf(animalDog{})}, err: "json: discriminator type *json_test.animalCat is not allowed for json_test.animal"},
+		} {
+			tc := tc // capture the loop variable
+			t.Run(tc.name, func(t *testing.T) {
+				c := json.NewCodec(json.CodecOptions{
+					TypeRegistry: newAnimalRegistryForTests(t, tc.allowed...),
+				})
+				data, err := c.Marshal(animalOwner{Pet: nilCat})
+				if tc.err != "" {
+					if a, e := err, tc.err; a == nil || a.Error() != e {
+						t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if a, e := string(data), `{"pet":{"kind":"*cat","value":null}}`; a != e {
+					t.Errorf("mismatch: e=%s, a=%s", e, a)
+				}
+				var obj animalOwner
+				if err := c.Unmarshal(data, &obj); err != nil {
+					t.Fatal(err)
+				}
+				if obj.Pet == nil {
+					t.Fatal("expected typed nil *animalCat, got nil interface")
+				}
+				assertDeepEqual(t, obj, animalOwner{Pet: nilCat})
+			})
+		}
+	})
+}
@@ -0,0 +1,350 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+type typeNamerDog struct {
+	Name string `json:"name"`
+}
+
+func (typeNamerDog) JSONTypeName() string { return "dog" }
+
+type typeNamerCat struct {
+	Name string `json:"name"`
+}
+
+func (*typeNamerCat) JSONTypeName() string { return "cat" }
+
+type typeNamerInvalid struct{}
+
+func (typeNamerInvalid) JSONTypeName() string { return "a]b" }
+
+type typeNameTagBird struct {
+	_    struct{} `jsontype:"bird"`
+	Name string   `json:"name"`
+}
+
+type typeNameTagFish struct {
+	_    struct{} `jsontype:""`
+	Name string   `json:"name"`
+}
+
+func vimTypeName(t reflect.Type) (string, bool) {
+	if t.PkgPath() == "github.com/akutz/gdj_test" && strings.HasPrefix(t.Name(), "DS") {
+		return "vim." + t.Name(), true
+	}
+	return "", false
+}
+
+func TestTypeName(t *testing.T) {
+	r := json.NewTypeRegistry()
+	for _, obj := range []interface{}{
+		typeNamerDog{}, typeNamerCat{}, typeNameTagBird{}, typeNameTagFish{},
+	} {
+		if err := r.Register(reflect.TypeOf(obj), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Register(reflect.TypeOf(DS3{}), "vim.DS3"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		obj    interface{}
+		str    string
+		typeFn json.TypeToDiscriminatorFunc
+	}{
+		{name: "method", obj: DS1{F1: typeNamerDog{Name: "a"}}, str: `{"f1":{"_t":"dog","name":"a"}}`},
+		{name: "pointer method", obj: DS1{F1: typeNamerCat{Name: "a"}}, str: `{"f1":{"_t":"cat","name":"a"}}`},
+		{name: "struct tag", obj: DS1{F1: typeNameTagBird{Name: "a"}}, str: `{"f1":{"_t":"bird","name":"a"}}`},
+		{name: "empty struct tag", obj: DS1{F1: typeNameTagFish{Name: "a"}}, str: `{"f1":{"_t":"typeNameTagFish","name":"a"}}`},
+		{name: "composite", obj: DS1{F1: []typeNamerDog{{Name: "a"}}}, str: `{"f1":{"_t":"[]dog","_v":[{"name":"a"}]}}`},
+		{name: "func", obj: DS1{F1: DS3{F1: "a"}}, str: `{"f1":{"_t":"vim.DS3","f1":"a"}}`, typeFn: vimTypeName},
+		{name: "func falls back", obj: DS1{F1: typeNamerDog{Name: "a"}}, str: `{"f1":{"_t":"dog","name":"a"}}`, typeFn: vimTypeName},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var w bytes.Buffer
+			enc := json.NewEncoder(&w)
+			enc.SetDiscriminator("_t", "_v", 0)
+			enc.SetTypeNameFunc(tc.typeFn)
+			if err := enc.Encode(tc.obj); err != nil {
+				t.Fatal(err)
+			}
+			if a, e := w.String(), tc.str+"\n"; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			dec := json.NewDecoder(&w)
+			dec.SetDiscriminator("_t", "_v", nil)
+			dec.SetTypeRegistry(r)
+			obj := reflect.New(reflect.TypeOf(tc.obj))
+			if err := dec.Decode(obj.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			assertDeepEqual(t, obj.Elem().Interface(), tc.obj)
+		})
+	}
+}
+
+func TestParseTypeName(t *testing.T) {
+	r := json.NewTypeRegistry()
+	if err := r.Register(reflect.TypeOf(DS3{}), "DS3", "example.com/pkg.DS3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(reflect.TypeOf(typeNamerDog{}), "dog"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		tn  string
+		t   reflect.Type
+		err string
+	}{
+		{tn: "[][]int", t: reflect.TypeOf([][]int{})},
+		{tn: "map[string][]DS3", t: reflect.TypeOf(map[string][]DS3{})},
+		{tn: "[]map[string]*DS3", t: reflect.TypeOf([]map[string]*DS3{})},
+		{tn: "*[]int", t: reflect.TypeOf(&[]int{})},
+		{tn: "**DS3", t: reflect.TypeOf((**DS3)(nil))},
+		{tn: "map[[2]int]string", t: reflect.TypeOf(map[[2]int]string{})},
+		{tn: "map[string]map[int][3]*dog", t: reflect.TypeOf(map[string]map[int][3]*typeNamerDog{})},
+		{tn: "[]interface {}", t: reflect.TypeOf([]interface{}{})},
+		{tn: "map[string]interface{}", t: reflect.TypeOf(map[string]interface{}{})},
+		{tn: "[]example.com/pkg.DS3", t: reflect.TypeOf([]DS3{})},
+		{tn: "mapStringIntNoop", t: reflect.TypeOf(mapStringIntNoop{})},
+		{tn: "[]DS9", err: "json: invalid type DS9 in discriminator type: []DS9"},
+		{tn: "map[]int", err: "json: invalid discriminator type syntax at offset 4: map[]int"},
+		{tn: "[2", err: "json: invalid discriminator type syntax at offset 2: [2"},
+		{tn: "[x]int", err: "json: invalid discriminator type syntax at offset 1: [x]int"},
+		{tn: "[]int]", err: "json: invalid discriminator type syntax at offset 5: []int]"},
+		{tn: "map[[]int]string", err: "json: invalid map key type []int in discriminator type: map[[]int]string"},
+		{tn: "struct {}", t: reflect.TypeOf(struct{}{})},
+		{tn: `struct { A int \"json:\\\"a\\\"\"; B []DS3 }`, t: reflect.TypeOf(struct {
+			A int `json:"a"`
+			B []DS3
+		}{})},
+		{tn: "struct { DS3; X interface {}; Y map[string]struct { Z *dog } }", t: reflect.TypeOf(struct {
+			DS3
+			X interface{}
+			Y map[string]struct{ Z *typeNamerDog }
+		}{})},
+		{tn: "[]struct { A int }", t: reflect.TypeOf([]struct{ A int }{})},
+		{tn: "struct { a int }", err: "json: invalid discriminator type syntax at offset 10: struct { a int }"},
+		{tn: "struct { A int", err: "json: invalid discriminator type syntax at offset 14: struct { A int"},
+		{tn: `struct { A int \"a`, err: `json: invalid discriminator type syntax at offset 15: struct { A int "a`},
+		{tn: "struct { A int; A string }", err: "json: invalid discriminator type struct { A int; A string }: reflect.StructOf: duplicate field A"},
+		{tn: "struct { *[]int }", err: "json: invalid embedded field []int in discriminator type: struct { *[]int }"},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.tn, func(t *testing.T) {
+			dec := json.NewDecoder(strings.NewReader(`{"_t":"` + tc.tn + `"}`))
+			dec.SetDiscriminator("_t", "_v", discriminatorToTypeFn)
+			dec.SetTypeRegistry(r)
+			_, typ, err := dec.PeekDiscriminator()
+			if tc.err != "" {
+				if err == nil || err.Error() != tc.err {
+					t.Errorf("expected error mismatch: e=%v, a=%v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if typ != tc.t {
+				t.Errorf("mismatch: e=%v, a=%v", tc.t, typ)
+			}
+		})
+	}
+}
+
+func TestCompositeTypeNameRoundTrip(t *testing.T) {
+	for _, obj := range []interface{}{
+		DS1{F1: [][]int{{1, 2}, {3}}},
+		DS1{F1: map[string][]DS3{"a": {{F1: "b"}}}},
+		DS1{F1: []map[string]*DS3{{"a": {F1: "b"}}}},
+		DS1{F1: [2][]string{{"a"}, {"b"}}},
+		DS1{F1: map[string]map[string][1]uint8{"a": {"b": {1}}}},
+		DS1{F1: struct{}{}},
+		DS1{F1: struct {
+			A int `json:"a"`
+			B []struct{ C string }
+			D interface{} `json:"d,omitempty"`
+		}{A: 1, B: []struct{ C string }{{C: "b"}}, D: DS3{F1: "c"}}},
+		DS1{F1: struct {
+			DS3
+			E *DS3 `json:"e"`
+		}{DS3: DS3{F1: "a"}, E: &DS3{F1: "b"}}},
+		DS1{F1: []struct{ A uint8 }{{A: 1}}},
+		DS1{F1: map[string]struct{}{"a": {}}},
+	} {
+		data, err := json.MarshalWithDiscriminator(obj, "_t", "_v", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var a DS1
+		if err := json.UnmarshalWithDiscriminator(data, &a, "_t", "_v", discriminatorToTypeFn); err != nil {
+			t.Fatalf("%s: %v", data, err)
+		}
+		assertDeepEqual(t, a, obj)
+	}
+
+	t.Run("Anonymous struct", func(t *testing.T) {
+		data, err := json.MarshalWithDiscriminator(DS1{F1: struct {
+			A int `json:"a"`
+		}{A: 1}}, "_t", "_v", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, e := string(data), `{"f1":{"_t":"struct { A int \"json:\\\"a\\\"\" }","a":1}}`; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+	})
+}
+
+func TestCompositeTypeNameElems(t *testing.T) {
+	qualifiedToTypeFn := func(name string) (reflect.Type, bool) {
+		return discriminatorToTypeFn(strings.TrimPrefix(name, "json_test."))
+	}
+	for _, tc := range []struct {
+		name string
+		obj  DS1
+		str  string
+		mode json.DiscriminatorEncodeMode
+	}{
+		{name: "Slice", obj: DS1{F1: []DS3{{F1: "a"}}}, str: `{"f1":{"_t":"[]DS3","_v":[{"f1":"a"}]}}`},
+		{name: "Array", obj: DS1{F1: [1]DS3{{F1: "a"}}}, str: `{"f1":{"_t":"[1]DS3","_v":[{"f1":"a"}]}}`},
+		{name: "Map", obj: DS1{F1: map[string]*DS3{"a": {F1: "b"}}}, str: `{"f1":{"_t":"map[string]*DS3","a":{"f1":"b"}}}`},
+		{name: "Defined name", obj: DS1{F1: []typeNamerDog{{Name: "a"}}}, str: `{"f1":{"_t":"[]dog","_v":[{"name":"a"}]}}`},
+		{name: "Qualified slice", obj: DS1{F1: []DS3{{F1: "a"}}}, str: `{"f1":{"_t":"[]json_test.DS3","_v":[{"f1":"a"}]}}`, mode: json.DiscriminatorEncodeTypeNameQualifiedElems},
+		{name: "Qualified map", obj: DS1{F1: map[string]*DS3{"a": {F1: "b"}}}, str: `{"f1":{"_t":"map[string]*json_test.DS3","a":{"f1":"b"}}}`, mode: json.DiscriminatorEncodeTypeNameQualifiedElems},
+		{name: "Qualified struct", obj: DS1{F1: struct{ A DS3 }{A: DS3{F1: "a"}}}, str: `{"f1":{"_t":"struct { A json_test.DS3 }","A":{"f1":"a"}}}`, mode: json.DiscriminatorEncodeTypeNameQualifiedElems},
+		{name: "Qualified defined name", obj: DS1{F1: []typeNamerDog{{Name: "a"}}}, str: `{"f1":{"_t":"[]dog","_v":[{"name":"a"}]}}`, mode: json.DiscriminatorEncodeTypeNameQualifiedElems},
+		{name: "Qualified root", obj: DS1{F1: DS3{F1: "a"}}, str: `{"f1":{"_t":"DS3","f1":"a"}}`, mode: json.DiscriminatorEncodeTypeNameQualifiedElems},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.MarshalWithDiscriminator(tc.obj, "_t", "_v", tc.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := string(data), tc.str; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			r := json.NewTypeRegistry()
+			if err := r.Register(reflect.TypeOf(typeNamerDog{}), ""); err != nil {
+				t.Fatal(err)
+			}
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.SetDiscriminator("_t", "_v", qualifiedToTypeFn)
+			dec.SetTypeRegistry(r)
+			var obj DS1
+			if err := dec.Decode(&obj); err != nil {
+				t.Fatal(err)
+			}
+			assertDeepEqual(t, obj, tc.obj)
+		})
+	}
+}
+
+func TestInvalidTypeName(t *testing.T) {
+	_, err := json.MarshalWithDiscriminator(DS1{F1: typeNamerInvalid{}}, "_t", "_v", 0)
+	if a, e := err, `json: discriminator type name "a]b" of json_test.typeNamerInvalid cannot be parsed`; a == nil || a.Error() != e {
+		t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+	}
+
+	// A struct type with unexported fields cannot be constructed when it is
+	// decoded.
+	_, err = json.MarshalWithDiscriminator(DS1{F1: struct{ a int }{}}, "_t", "_v", 0)
+	if a, e := err, `json: discriminator type name "struct { a int }" of struct { a int } cannot be parsed`; a == nil || a.Error() != e {
+		t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+	}
+
+	// The type name of a struct that is not stored in an interface is not
+	// used to decode it, so it need not be parsed.
+	type owner struct {
+		X struct{ a, B int }
+	}
+	obj := owner{}
+	obj.X.B = 1
+	data, err := json.MarshalWithDiscriminator(obj, "_t", "_v", json.DiscriminatorEncodeTypeNameAllObjects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, e := string(data), `{"_t":"owner","X":{"_t":"struct { a int; B int }","B":1}}`; a != e {
+		t.Errorf("mismatch: e=%s, a=%s", e, a)
+	}
+	var obj2 owner
+	if err := json.UnmarshalWithDiscriminator(data, &obj2, "_t", "_v", discriminatorToTypeFn); err != nil {
+		t.Fatal(err)
+	}
+	assertDeepEqual(t, obj2, obj)
+}
+
+func TestOmitUnparseableTypeName(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		mode json.DiscriminatorEncodeMode
+		obj  DS1
+		str  string
+		exp  DS1
+	}{
+		{
+			name: "Anonymous struct",
+			obj:  DS1{F1: struct{ a, B int }{B: 1}},
+			str:  `{"f1":{"B":1}}`,
+			exp:  DS1{F1: map[string]interface{}{"B": 1.0}},
+		},
+		{
+			name: "Slice of anonymous structs",
+			obj:  DS1{F1: []struct{ a, B int }{{B: 1}}},
+			str:  `{"f1":[{"B":1}]}`,
+			exp:  DS1{F1: []interface{}{map[string]interface{}{"B": 1.0}}},
+		},
+		{
+			name: "Invalid type name",
+			obj:  DS1{F1: typeNamerInvalid{}},
+			str:  `{"f1":{}}`,
+			exp:  DS1{F1: map[string]interface{}{}},
+		},
+		{
+			name: "All objects",
+			mode: json.DiscriminatorEncodeTypeNameAllObjects,
+			obj:  DS1{F1: map[string]struct{ a, B int }{"a": {B: 1}}},
+			str:  `{"_t":"DS1","f1":{"a":{"B":1}}}`,
+			exp:  DS1{F1: map[string]interface{}{"a": map[string]interface{}{"B": 1.0}}},
+		},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.MarshalWithDiscriminator(
+				tc.obj, "_t", "_v", tc.mode|json.DiscriminatorEncodeTypeNameOmitUnparseable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := string(data), tc.str; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+			var obj DS1
+			if err := json.UnmarshalWithDiscriminator(data, &obj, "_t", "_v", discriminatorToTypeFn); err != nil {
+				t.Fatal(err)
+			}
+			assertDeepEqual(t, obj, tc.exp)
+		})
+	}
+}
+
+func assertDeepEqual(t *testing.T, a, e interface{}) {
+	t.Helper()
+	if !reflect.DeepEqual(a, e) {
+		t.Errorf("mismatch: e=%+v, a=%+v", e, a)
+	}
+}
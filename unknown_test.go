@@ -0,0 +1,145 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"errors"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+func TestUnknownDiscriminated(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		layout json.DiscriminatorLayout
+		str    string
+		obj    DS1
+	}{
+		{name: "Inline type first", str: `{"f1":{"_t":"DS9","f1":"a","f2":[1, 2]}}`, obj: DS1{F1: json.UnknownDiscriminated{TypeName: "DS9", Raw: json.RawMessage(`{"_t":"DS9","f1":"a","f2":[1, 2]}`)}}},
+		{name: "Inline type last", str: `{"f1":{ "f1":{"_t":"DS3"} ,"_t":"DS9" }}`, obj: DS1{F1: json.UnknownDiscriminated{TypeName: "DS9", Raw: json.RawMessage(`{ "f1":{"_t":"DS3"} ,"_t":"DS9" }`)}}},
+		{name: "Inline value", str: `{"f1":{"_t":"uint9","_v":1}}`, obj: DS1{F1: json.UnknownDiscriminated{TypeName: "uint9", Raw: json.RawMessage(`{"_t":"uint9","_v":1}`)}}},
+		{name: "Adjacent", layout: json.DiscriminatorLayoutAdjacent, str: `{"f1":{"_t":"DS9","_v":{"f1":"a"}}}`, obj: DS1{F1: json.UnknownDiscriminated{TypeName: "DS9", Raw: json.RawMessage(`{"_t":"DS9","_v":{"f1":"a"}}`)}}},
+		{name: "External", layout: json.DiscriminatorLayoutExternal, str: `{"f1":{"DS9":{"f1":"a"}}}`, obj: DS1{F1: json.UnknownDiscriminated{TypeName: "DS9", Raw: json.RawMessage(`{"DS9":{"f1":"a"}}`)}}},
+		{name: "Tuple", layout: json.DiscriminatorLayoutTuple, str: `{"f1":["DS9",{"f1":"a"}]}`, obj: DS1{F1: json.UnknownDiscriminated{TypeName: "DS9", Raw: json.RawMessage(`["DS9",{"f1":"a"}]`)}}},
+	} {
+		tc := tc // capture the loop variable
+		t.Run(tc.name, func(t *testing.T) {
+			c := json.NewCodec(json.CodecOptions{
+				TypeFieldName:  "_t",
+				ValueFieldName: "_v",
+				TypeFn:         discriminatorToTypeFn,
+				Layout:         tc.layout,
+				UnknownTypeFn:  json.NewUnknownDiscriminated,
+			})
+			var obj DS1
+			if err := c.Unmarshal([]byte(tc.str), &obj); err != nil {
+				t.Fatal(err)
+			}
+			assertDeepEqual(t, obj, tc.obj)
+
+			data, err := c.Marshal(obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a, e := string(data), tc.str; a != e {
+				t.Errorf("mismatch: e=%s, a=%s", e, a)
+			}
+		})
+	}
+
+	t.Run("Array", func(t *testing.T) {
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeFn:         discriminatorToTypeFn,
+			UnknownTypeFn:  json.NewUnknownDiscriminated,
+		})
+		str := `[{"_t":"DS3","f1":"a"},{"_t":"DS9","f1":"b"},{"_t":"uint8","_v":1}]`
+		var obj []interface{}
+		if err := c.Unmarshal([]byte(str), &obj); err != nil {
+			t.Fatal(err)
+		}
+		assertDeepEqual(t, obj, []interface{}{
+			DS3{F1: "a"},
+			json.UnknownDiscriminated{TypeName: "DS9", Raw: json.RawMessage(`{"_t":"DS9","f1":"b"}`)},
+			uint8(1),
+		})
+	})
+
+	t.Run("Not assignable", func(t *testing.T) {
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeFn:         discriminatorToTypeFn,
+			UnknownTypeFn:  json.NewUnknownDiscriminated,
+		})
+		var obj DS2
+		err := c.Unmarshal([]byte(`{"f1":{"_t":"DS9"}}`), &obj)
+		if a, e := err, `json: invalid discriminator type: DS9`; a == nil || a.Error() != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+		}
+	})
+
+	t.Run("UnknownTypeFunc", func(t *testing.T) {
+		errUnknown := errors.New("unknown")
+		c := json.NewCodec(json.CodecOptions{
+			TypeFieldName:  "_t",
+			ValueFieldName: "_v",
+			TypeFn:         discriminatorToTypeFn,
+			UnknownTypeFn: func(typeName string, data json.RawMessage) (interface{}, error) {
+				switch typeName {
+				case "DS10":
+					return DS3{F1: string(data)}, nil
+				case "DS9":
+					return nil, errUnknown
+				}
+				return nil, nil
+			},
+		})
+		for _, tc := range []struct {
+			str string
+			obj DS1
+			err error
+		}{
+			{str: `{"f1":{"_t":"DS10"}}`, obj: DS1{F1: DS3{F1: `{"_t":"DS10"}`}}},
+			{str: `{"f1":{"_t":"DS9"}}`, err: errUnknown},
+			{str: `{"f1":{"_t":"DS11"}}`, err: errors.New(`json: invalid discriminator type: DS11`)},
+		} {
+			var obj DS1
+			err := c.Unmarshal([]byte(tc.str), &obj)
+			if tc.err != nil {
+				if a, e := err, tc.err; a == nil || a.Error() != e.Error() {
+					t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tc.str, err)
+				continue
+			}
+			assertDeepEqual(t, obj, tc.obj)
+		}
+	})
+
+	t.Run("Invalid raw", func(t *testing.T) {
+		_, err := json.MarshalWithDiscriminator(
+			DS1{F1: json.UnknownDiscriminated{TypeName: "DS9", Raw: json.RawMessage(`{`)}},
+			"_t", "_v", 0)
+		if a, e := err, `json: unsupported value: invalid JSON for unknown type DS9`; a == nil || a.Error() != e {
+			t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+		}
+	})
+
+	t.Run("Without discriminator", func(t *testing.T) {
+		data, err := json.Marshal(DS1{F1: json.UnknownDiscriminated{TypeName: "DS9", Raw: json.RawMessage(`{"_t": "DS9"}`)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a, e := string(data), `{"f1":{"_t":"DS9"}}`; a != e {
+			t.Errorf("mismatch: e=%s, a=%s", e, a)
+		}
+	})
+}
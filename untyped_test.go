@@ -0,0 +1,108 @@
+// Copyright 2023 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package json_test
+
+import (
+	"reflect"
+	"testing"
+
+	json "github.com/akutz/gdj"
+)
+
+func TestDiscriminatorUntypedObject(t *testing.T) {
+	t.Run("Empty interface", func(t *testing.T) {
+		for _, tc := range []struct {
+			str string
+			obj interface{}
+		}{
+			{str: `{}`, obj: map[string]interface{}{}},
+			{str: `{"a":1}`, obj: map[string]interface{}{"a": 1.0}},
+			{str: `{"a":{"b":[1,{"c":"d"}]}}`, obj: map[string]interface{}{"a": map[string]interface{}{"b": []interface{}{1.0, map[string]interface{}{"c": "d"}}}}},
+			{str: `{"a":{"_t":"DS3","f1":"b"}}`, obj: map[string]interface{}{"a": DS3{F1: "b"}}},
+			{str: `{"a":{"_t":"uint8","_v":1},"b":{"c":1}}`, obj: map[string]interface{}{"a": uint8(1), "b": map[string]interface{}{"c": 1.0}}},
+			{str: `{"a":[{"_t":"DS3","f1":"b"},[{"_t":"uint8","_v":1}],{"c":1}]}`, obj: map[string]interface{}{"a": []interface{}{DS3{F1: "b"}, []interface{}{uint8(1)}, map[string]interface{}{"c": 1.0}}}},
+			{str: `[{"_t":"DS3","f1":"b"},2]`, obj: []interface{}{DS3{F1: "b"}, 2.0}},
+		} {
+			var obj interface{}
+			if err := json.UnmarshalWithDiscriminator(
+				[]byte(tc.str), &obj, "_t", "_v", discriminatorToTypeFn); err != nil {
+				t.Errorf("%s: unexpected error: %v", tc.str, err)
+				continue
+			}
+			assertDeepEqual(t, obj, tc.obj)
+
+			var obj2 DS1
+			if err := json.UnmarshalWithDiscriminator(
+				[]byte(`{"f1":`+tc.str+`}`), &obj2, "_t", "_v", discriminatorToTypeFn); err != nil {
+				t.Errorf("%s: unexpected error: %v", tc.str, err)
+				continue
+			}
+			assertDeepEqual(t, obj2, DS1{F1: tc.obj})
+		}
+	})
+
+	t.Run("Default type", func(t *testing.T) {
+		for _, tc := range []struct {
+			typ reflect.Type
+			str string
+			obj animalOwner
+			err string
+		}{
+			{str: `{"pet":{"name":"a"}}`, err: `json: missing discriminator`},
+			{typ: reflect.TypeOf(animalDog{}), str: `{"pet":{"name":"a"}}`, obj: animalOwner{Pet: animalDog{Name: "a"}}},
+			{typ: reflect.TypeOf(animalCat{}), str: `{"pet":{"name":"a"}}`, obj: animalOwner{Pet: &animalCat{Name: "a"}}},
+			{typ: reflect.TypeOf(animalDog{}), str: `{"pet":{"kind":"cat","name":"a"}}`, obj: animalOwner{Pet: &animalCat{Name: "a"}}},
+			{typ: reflect.TypeOf(animalDog{}), str: `{"pet":{"name":"a"},"other":{"a":1}}`, obj: animalOwner{Pet: animalDog{Name: "a"}, Other: map[string]interface{}{"a": 1.0}}},
+		} {
+			types := json.NewTypeRegistry()
+			if err := types.Register(reflect.TypeOf(animalCat{}), "cat"); err != nil {
+				t.Fatal(err)
+			}
+			r := json.NewTypeRegistry()
+			if err := r.RegisterInterface(animalType, json.InterfaceDiscriminator{
+				TypeFieldName:  "kind",
+				ValueFieldName: "value",
+				Types:          types,
+				DefaultType:    tc.typ,
+			}); err != nil {
+				t.Fatal(err)
+			}
+			c := json.NewCodec(json.CodecOptions{
+				TypeFieldName:  "_t",
+				ValueFieldName: "_v",
+				TypeRegistry:   r,
+			})
+			var obj animalOwner
+			err := c.Unmarshal([]byte(tc.str), &obj)
+			if tc.err != "" {
+				if a, e := err, tc.err; a == nil || a.Error() != e {
+					t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", tc.str, err)
+				continue
+			}
+			assertDeepEqual(t, obj, tc.obj)
+		}
+	})
+
+	t.Run("Register errors", func(t *testing.T) {
+		r := json.NewTypeRegistry()
+		for _, tc := range []struct {
+			id  json.InterfaceDiscriminator
+			err string
+		}{
+			{id: json.InterfaceDiscriminator{DefaultType: reflect.TypeOf(DS3{})}, err: `json: default type json_test.DS3 does not implement json_test.animal`},
+			{id: json.InterfaceDiscriminator{DefaultType: reflect.TypeOf(animalFish(0)), AllowedTypes: []reflect.Type{reflect.TypeOf(animalDog{})}}, err: `json: default type json_test.animalFish is not allowed for json_test.animal`},
+		} {
+			err := r.RegisterInterface(animalType, tc.id)
+			if a, e := err, tc.err; a == nil || a.Error() != e {
+				t.Errorf("expected error mismatch: e=%v, a=%v", e, a)
+			}
+		}
+	})
+}